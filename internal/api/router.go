@@ -2,11 +2,19 @@ package api
 
 import (
 	"database/sql"
+	"errors"
+	"io"
 	"net/http"
+	"strconv"
+	"strings"
+	"time"
 
+	"github.com/cyberhawk12121/Saarthi/internal/middleware"
 	"github.com/cyberhawk12121/Saarthi/internal/service"
 	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+	"github.com/cyberhawk12121/Saarthi/internal/storage"
 
+	"github.com/gin-contrib/sse"
 	"github.com/gin-gonic/gin"
 )
 
@@ -27,8 +35,519 @@ func SetupRoutes(router *gin.Engine, db *sql.DB) {
 		c.JSON(http.StatusOK, gin.H{"message": "User registered successfully"})
 	})
 
-	router.POST("/upload", func(c *gin.Context) {
+	router.POST("/login", func(c *gin.Context) {
+		var req types.LoginRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		resp, err := userService.LoginUser(req, c.Request.UserAgent(), c.ClientIP())
+		if errors.Is(err, service.ErrInvalidCredentials) {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setRefreshCookie(c, resp)
+		c.JSON(http.StatusOK, resp)
+	})
+
+	router.POST("/auth/refresh", func(c *gin.Context) {
+		// Browsers send the cookie, other clients the token in the body
+		var req types.RefreshRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+		if req.RefreshToken == "" {
+			req.RefreshToken, _ = c.Cookie("refresh_token")
+		}
+
+		resp, err := userService.RefreshTokens(req.RefreshToken)
+		if errors.Is(err, service.ErrInvalidRefreshToken) || errors.Is(err, service.ErrRefreshTokenReused) {
+			clearRefreshCookie(c)
+			c.JSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		setRefreshCookie(c, resp)
+		c.JSON(http.StatusOK, resp)
+	})
+
+	// URLs presigned by the local and memory storage backends. The signature in
+	// the query is the authorization, like with S3.
+	router.PUT("/storage/*key", func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		info, err := userService.PutSignedObject(c.Request.Context(), key, c.Request.URL.Query(), c.Request.Body)
+		switch {
+		case errors.Is(err, storage.ErrInvalidSignature):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, storage.ErrInvalidKey):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUploadTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrAlreadyUploaded):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.Header("ETag", `"`+info.ETag+`"`)
+			c.Status(http.StatusOK)
+		}
+	})
+
+	router.GET("/storage/*key", func(c *gin.Context) {
+		key := strings.TrimPrefix(c.Param("key"), "/")
+		obj, err := userService.GetSignedObject(c.Request.Context(), key, c.Request.URL.Query())
+		switch {
+		case errors.Is(err, storage.ErrInvalidSignature):
+			c.JSON(http.StatusForbidden, gin.H{"error": err.Error()})
+		case errors.Is(err, storage.ErrNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			defer obj.Close()
+			c.DataFromReader(http.StatusOK, -1, "application/octet-stream", obj, nil)
+		}
+	})
+
+	// Everything below needs a valid access token
+	authorized := router.Group("/")
+	authorized.Use(userService.AuthMiddleware())
+	// Event streams and sockets also take a stream token in the URL, browsers
+	// can't set headers on them
+	streams := router.Group("/")
+	streams.Use(userService.StreamAuthMiddleware())
+
+	authorized.POST("/logout", func(c *gin.Context) {
+		if err := userService.Logout(middleware.UserID(c), middleware.SessionID(c)); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		clearRefreshCookie(c)
+		c.JSON(http.StatusOK, gin.H{"message": "Logged out"})
+	})
+
+	authorized.POST("/auth/stream-token", func(c *gin.Context) {
+		resp, err := userService.IssueStreamToken(middleware.UserID(c), middleware.SessionID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, resp)
+	})
+
+	authorized.GET("/sessions", func(c *gin.Context) {
+		sessions, err := userService.ListSessions(middleware.UserID(c), middleware.SessionID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"sessions": sessions})
+	})
+
+	authorized.DELETE("/sessions/:id", func(c *gin.Context) {
+		err := userService.RevokeSession(middleware.UserID(c), c.Param("id"))
+		if errors.Is(err, service.ErrSessionNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "Session signed out"})
+	})
+
+	authorized.GET("/preferences", func(c *gin.Context) {
+		prefs, err := userService.GetPreferences(middleware.UserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, prefs)
+	})
+
+	authorized.PUT("/preferences", func(c *gin.Context) {
+		var req types.Preferences
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		prefs, err := userService.UpdatePreferences(middleware.UserID(c), req)
+		if errors.Is(err, service.ErrUnsupportedLanguage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, prefs)
+	})
+
+	authorized.POST("/upload", func(c *gin.Context) {
 		userService.UploadAudio(c)
 	})
 
+	streams.GET("/live", func(c *gin.Context) {
+		userService.LiveTranscription(c)
+	})
+
+	authorized.POST("/recordings", func(c *gin.Context) {
+		var req types.CreateRecordingRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		resp, err := userService.CreateRecordingUpload(c.Request.Context(), middleware.UserID(c), req)
+		if errors.Is(err, service.ErrUploadTooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+			return
+		}
+		if errors.Is(err, service.ErrUnsupportedLanguage) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusCreated, resp)
+	})
+
+	authorized.POST("/recordings/:id/complete", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording id"})
+			return
+		}
+		var req types.CompleteRecordingRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		jobId, err := userService.CompleteRecordingUpload(c.Request.Context(), middleware.UserID(c), id, req)
+		switch {
+		case errors.Is(err, service.ErrRecordingNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUploadIncomplete), errors.Is(err, service.ErrAlreadyUploaded):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUploadTooLarge):
+			c.JSON(http.StatusRequestEntityTooLarge, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusAccepted, gin.H{"job_id": jobId})
+		}
+	})
+
+	authorized.POST("/recordings/:id/reprocess", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording id"})
+			return
+		}
+		var req types.ReprocessRequest
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&req); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		jobId, err := userService.ReprocessRecording(middleware.UserID(c), id, req)
+		switch {
+		case errors.Is(err, service.ErrRecordingNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUploadIncomplete):
+			c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		case errors.Is(err, service.ErrUnsupportedLanguage):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusAccepted, gin.H{"job_id": jobId})
+		}
+	})
+
+	streams.GET("/recordings/:id/events", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording id"})
+			return
+		}
+		// EventSource sends the last ID it saw when it reconnects
+		lastEventId, _ := strconv.ParseInt(c.GetHeader("Last-Event-ID"), 10, 64)
+
+		ch, cancel, err := userService.RecordingEvents(middleware.UserID(c), id, lastEventId)
+		if errors.Is(err, service.ErrRecordingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		defer cancel()
+
+		c.Header("Cache-Control", "no-cache")
+		// Keep nginx from buffering the stream
+		c.Header("X-Accel-Buffering", "no")
+		keepAlive := time.NewTicker(15 * time.Second)
+		defer keepAlive.Stop()
+
+		written := false
+		c.Stream(func(w io.Writer) bool {
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case event, ok := <-ch:
+				if !ok {
+					// The run is over, or we fell behind and the client
+					// reconnects and catches up. A reconnect that finds
+					// nothing new gets 204, which stops EventSource for good.
+					if !written {
+						c.Status(http.StatusNoContent)
+					}
+					return false
+				}
+				written = true
+				c.Render(-1, sse.Event{Id: strconv.FormatInt(event.ID, 10), Event: event.Type, Data: event.Data})
+				return true
+			case <-keepAlive.C:
+				written = true
+				_, err := io.WriteString(w, ": keep-alive\n\n")
+				return err == nil
+			}
+		})
+	})
+
+	authorized.GET("/recordings/:id/summaries", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording id"})
+			return
+		}
+		versions, err := userService.ListSummaryVersions(id, middleware.UserID(c))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"summaries": versions})
+	})
+
+	authorized.GET("/recordings/:id/action-items", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid recording id"})
+			return
+		}
+		items, err := userService.ListRecordingActionItems(id, middleware.UserID(c))
+		if errors.Is(err, service.ErrRecordingNotFound) {
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"action_items": items})
+	})
+
+	authorized.GET("/jobs/:id", func(c *gin.Context) {
+		job, err := userService.GetJob(c.Param("id"), middleware.UserID(c))
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Job not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, job)
+	})
+
+	authorized.GET("/providers/status", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"providers": userService.ProviderStatus()})
+	})
+
+	authorized.GET("/action-items", func(c *gin.Context) {
+		items, err := userService.ListActionItems(middleware.UserID(c), c.Query("status"))
+		if errors.Is(err, service.ErrInvalidStatus) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"action_items": items})
+	})
+
+	authorized.PATCH("/action-items/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid action item id"})
+			return
+		}
+		var req types.UpdateActionItemRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		item, err := userService.UpdateActionItem(id, middleware.UserID(c), req)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Action item not found"})
+		case errors.Is(err, service.ErrInvalidStatus):
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, item)
+		}
+	})
+
+	authorized.GET("/summaries", func(c *gin.Context) {
+		page, err := strconv.Atoi(c.DefaultQuery("page", "1"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid page"})
+			return
+		}
+		limit, err := strconv.Atoi(c.DefaultQuery("limit", "20"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid limit"})
+			return
+		}
+
+		summaries, err := userService.ListSummaries(middleware.UserID(c), page, limit)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summaries)
+	})
+
+	authorized.GET("/summaries/:id", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid summary id"})
+			return
+		}
+
+		summary, err := userService.GetSummary(id, middleware.UserID(c))
+		if errors.Is(err, sql.ErrNoRows) {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, summary)
+	})
+
+	authorized.POST("/summaries/:id/regenerate", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid summary id"})
+			return
+		}
+		// The body is optional, chunked ones have no length so look at it
+		var req types.RegenerateSummaryRequest
+		if c.Request.Body != nil && c.Request.Body != http.NoBody {
+			if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		// The reply turns into server-sent events once the LLM starts writing,
+		// errors before that are plain JSON
+		streaming := false
+		send := func(event string, data interface{}) {
+			if !streaming {
+				streaming = true
+				c.Header("Cache-Control", "no-cache")
+				c.Header("X-Accel-Buffering", "no")
+			}
+			c.Render(-1, sse.Event{Event: event, Data: data})
+			c.Writer.Flush()
+		}
+		onDelta := func(text string) {
+			send(service.EventSummaryDelta, types.SummaryDeltaEvent{Text: text})
+		}
+
+		// The request context ends when the client goes away, which stops the LLM
+		result, err := userService.RegenerateSummary(c.Request.Context(), id, middleware.UserID(c), req, onDelta)
+		switch {
+		case c.Request.Context().Err() != nil:
+			return
+		case err != nil && !streaming && errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		case err != nil && !streaming:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		case err != nil:
+			send("error", gin.H{"error": err.Error()})
+		default:
+			send(service.EventSummary, result)
+		}
+	})
+
+	authorized.PUT("/summaries/:id/speakers", func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid summary id"})
+			return
+		}
+		var req types.RenameSpeakerRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if strings.TrimSpace(req.Name) == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name must not be blank"})
+			return
+		}
+
+		summary, err := userService.RenameSpeaker(id, middleware.UserID(c), req)
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			c.JSON(http.StatusNotFound, gin.H{"error": "Summary not found"})
+		case errors.Is(err, service.ErrSpeakerNotFound):
+			c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		case err != nil:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		default:
+			c.JSON(http.StatusOK, summary)
+		}
+	})
+}
+
+// setRefreshCookie also hands the refresh token to browsers as an HttpOnly cookie.
+func setRefreshCookie(c *gin.Context, resp types.LoginResponse) {
+	maxAge := 0
+	if expiresAt, err := time.Parse(time.RFC3339, resp.RefreshExpiresAt); err == nil {
+		maxAge = int(time.Until(expiresAt).Seconds())
+	}
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("refresh_token", resp.RefreshToken, maxAge, "/", "", c.Request.TLS != nil, true)
+}
+
+func clearRefreshCookie(c *gin.Context) {
+	c.SetSameSite(http.SameSiteStrictMode)
+	c.SetCookie("refresh_token", "", -1, "/", "", c.Request.TLS != nil, true)
 }
@@ -0,0 +1,185 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Format identifies the container of an audio file.
+type Format string
+
+const (
+	FormatUnknown Format = ""
+	FormatWAV     Format = "wav"
+	FormatMP3     Format = "mp3"
+	FormatOGG     Format = "ogg"
+	FormatFLAC    Format = "flac"
+	FormatM4A     Format = "m4a"
+	FormatWebM    Format = "webm"
+)
+
+var ErrUnsupportedFormat = errors.New("audio format cannot be split")
+
+// Options controls where Split cuts the audio.
+type Options struct {
+	// MaxChunkBytes is a hard limit on the size of every chunk (headers included).
+	MaxChunkBytes int
+	// TargetDuration is the preferred length of a chunk.
+	TargetDuration time.Duration
+	// SearchWindow is how far back from the target we look for a quiet spot to cut at.
+	SearchWindow time.Duration
+	// Overlap is how much audio neighbouring chunks share, so words at the edges survive.
+	Overlap time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		MaxChunkBytes:  15 * 1024 * 1024, // 15 MB
+		TargetDuration: 10 * time.Minute,
+		SearchWindow:   20 * time.Second,
+		Overlap:        1500 * time.Millisecond,
+	}
+}
+
+// Chunk is a standalone, playable piece of the original recording.
+type Chunk struct {
+	Index  int
+	Format Format
+	Data   []byte
+	// Offset is where the chunk starts in the original recording.
+	Offset   time.Duration
+	Duration time.Duration
+}
+
+// unit is the smallest piece of audio we are allowed to cut around: an MP3
+// frame or a short window of PCM frames.
+type unit struct {
+	offset int // byte offset in the source data
+	size   int
+	start  time.Duration
+	dur    time.Duration
+	energy float64
+}
+
+// Detect looks at the magic bytes of data and returns its container format.
+func Detect(data []byte) Format {
+	switch {
+	case len(data) >= 12 && string(data[0:4]) == "RIFF" && string(data[8:12]) == "WAVE":
+		return FormatWAV
+	case bytes.HasPrefix(data, []byte("ID3")):
+		return FormatMP3
+	case bytes.HasPrefix(data, []byte("OggS")):
+		return FormatOGG
+	case bytes.HasPrefix(data, []byte("fLaC")):
+		return FormatFLAC
+	case len(data) >= 8 && string(data[4:8]) == "ftyp":
+		return FormatM4A
+	case bytes.HasPrefix(data, []byte{0x1A, 0x45, 0xDF, 0xA3}):
+		return FormatWebM
+	case len(data) >= 4:
+		if _, ok := parseMP3Header(data[0:4]); ok {
+			return FormatMP3
+		}
+	}
+	return FormatUnknown
+}
+
+// Split cuts an audio file into standalone chunks. WAV and MP3 are cut on frame
+// boundaries near silence; other formats are passed through whole as long as
+// they fit in a single chunk.
+func Split(data []byte, opts Options) ([]Chunk, error) {
+	if opts.MaxChunkBytes <= 0 || opts.TargetDuration <= 0 {
+		return nil, fmt.Errorf("invalid chunk options: %+v", opts)
+	}
+
+	format := Detect(data)
+	switch format {
+	case FormatWAV:
+		return splitWAV(data, opts)
+	case FormatMP3:
+		return splitMP3(data, opts)
+	}
+
+	if len(data) > opts.MaxChunkBytes {
+		return nil, fmt.Errorf("%w: %q is %d bytes, limit is %d", ErrUnsupportedFormat, format, len(data), opts.MaxChunkBytes)
+	}
+	return []Chunk{{Index: 0, Format: format, Data: data}}, nil
+}
+
+// span is a half-open range of units [first, last).
+type span struct {
+	first, last int
+}
+
+// plan decides where to cut. Every chunk stays under the byte and duration
+// limits, ends on the quietest unit inside the search window, and the next
+// chunk starts Overlap before that cut.
+func plan(units []unit, headerSize int, opts Options) []span {
+	smoothed := smoothEnergy(units, 300*time.Millisecond)
+
+	var spans []span
+	start := 0
+	for start < len(units) {
+		// Grow the chunk until the next unit would break one of the limits
+		end := start + 1
+		for end < len(units) {
+			size := units[end].offset + units[end].size - units[start].offset + headerSize
+			length := units[end].start + units[end].dur - units[start].start
+			if size > opts.MaxChunkBytes || length > opts.TargetDuration {
+				break
+			}
+			end++
+		}
+
+		if end == len(units) {
+			spans = append(spans, span{start, end})
+			break
+		}
+
+		// Look back from the limit for the quietest unit and cut right after it.
+		// Never cut in the first half of the chunk, or the overlap could stall us.
+		half := units[start].start + (units[end].start-units[start].start)/2
+		quietest := end - 1
+		for i := end - 1; i > start; i-- {
+			if units[end].start-units[i].start > opts.SearchWindow || units[i].start < half {
+				break
+			}
+			if smoothed[i] < smoothed[quietest] {
+				quietest = i
+			}
+		}
+		cut := quietest + 1
+		spans = append(spans, span{start, cut})
+
+		// Step back by the overlap, but always make progress
+		next := cut
+		for next-1 > start && units[cut].start-units[next-1].start <= opts.Overlap {
+			next--
+		}
+		start = next
+	}
+
+	return spans
+}
+
+// smoothEnergy averages every unit's energy over a window centred on it, so a
+// single quiet frame inside a word doesn't look like a pause.
+func smoothEnergy(units []unit, window time.Duration) []float64 {
+	smoothed := make([]float64, len(units))
+	lo, hi := 0, 0
+	var sum float64
+	for i := range units {
+		for hi < len(units) && units[hi].start-units[i].start <= window/2 {
+			sum += units[hi].energy
+			hi++
+		}
+		for units[i].start-units[lo].start > window/2 {
+			sum -= units[lo].energy
+			lo++
+		}
+		smoothed[i] = sum / float64(hi-lo)
+	}
+	return smoothed
+}
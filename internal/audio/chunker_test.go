@@ -0,0 +1,335 @@
+package audio
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// secondUnits builds n one-second units of 100 bytes each, silent at the given indexes.
+func secondUnits(n int, quiet ...int) []unit {
+	units := make([]unit, n)
+	for i := range units {
+		units[i] = unit{offset: i * 100, size: 100, start: time.Duration(i) * time.Second, dur: time.Second, energy: 1}
+	}
+	for _, i := range quiet {
+		units[i].energy = 0
+	}
+	return units
+}
+
+func TestPlan(t *testing.T) {
+	tests := []struct {
+		name       string
+		units      []unit
+		headerSize int
+		opts       Options
+		want       []span
+	}{
+		{
+			name:  "fits in one chunk",
+			units: secondUnits(5),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 10 * time.Second, SearchWindow: 5 * time.Second},
+			want:  []span{{0, 5}},
+		},
+		{
+			name:  "cuts after the quietest unit in the window",
+			units: secondUnits(30, 7),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 10 * time.Second, SearchWindow: 5 * time.Second},
+			want:  []span{{0, 8}, {8, 18}, {18, 28}, {28, 30}},
+		},
+		{
+			name:  "ignores pauses outside the window",
+			units: secondUnits(30, 2),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 10 * time.Second, SearchWindow: 5 * time.Second},
+			want:  []span{{0, 10}, {10, 20}, {20, 30}},
+		},
+		{
+			name:  "never cuts in the first half",
+			units: secondUnits(30, 3),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 10 * time.Second, SearchWindow: 9 * time.Second},
+			want:  []span{{0, 10}, {10, 20}, {20, 30}},
+		},
+		{
+			name:       "stays under the byte limit",
+			units:      secondUnits(10),
+			headerSize: 50,
+			opts:       Options{MaxChunkBytes: 450, TargetDuration: time.Hour, SearchWindow: 5 * time.Second},
+			want:       []span{{0, 4}, {4, 8}, {8, 10}},
+		},
+		{
+			name:  "next chunk starts overlap before the cut",
+			units: secondUnits(30),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 10 * time.Second, SearchWindow: 5 * time.Second, Overlap: 2 * time.Second},
+			want:  []span{{0, 10}, {8, 18}, {16, 26}, {24, 30}},
+		},
+		{
+			name:  "overlap longer than a chunk still makes progress",
+			units: secondUnits(6),
+			opts:  Options{MaxChunkBytes: 1 << 20, TargetDuration: 2 * time.Second, SearchWindow: time.Second, Overlap: time.Minute},
+			want:  []span{{0, 2}, {1, 3}, {2, 4}, {3, 5}, {4, 6}},
+		},
+		{
+			name:  "unit bigger than the limit gets a chunk of its own",
+			units: secondUnits(3),
+			opts:  Options{MaxChunkBytes: 10, TargetDuration: time.Hour, SearchWindow: time.Second},
+			want:  []span{{0, 1}, {1, 2}, {2, 3}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := plan(tt.units, tt.headerSize, tt.opts)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// between returns a quiet func for the given [from, to) ranges.
+func between(ranges ...[2]time.Duration) func(d time.Duration) bool {
+	return func(d time.Duration) bool {
+		for _, r := range ranges {
+			if d >= r[0] && d < r[1] {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+func TestSplit(t *testing.T) {
+	pauses := [][2]time.Duration{
+		{17 * time.Second, 17500 * time.Millisecond},
+		{34 * time.Second, 34500 * time.Millisecond},
+		{50 * time.Second, 50500 * time.Millisecond},
+	}
+	chunked := Options{
+		MaxChunkBytes:  15 * 1024 * 1024,
+		TargetDuration: 20 * time.Second,
+		SearchWindow:   5 * time.Second,
+		Overlap:        time.Second,
+	}
+	small := chunked
+	small.MaxChunkBytes = 100_000
+	small.TargetDuration = time.Hour
+	small.SearchWindow = 0
+
+	mp3Frames := func(d time.Duration) int { return int(d / mp3FrameDuration) }
+
+	tests := []struct {
+		name         string
+		data         []byte
+		opts         Options
+		wantChunks   int
+		wantDuration time.Duration
+		unitDuration time.Duration // longest unit, the overlap is rounded to units
+		pauses       [][2]time.Duration
+	}{
+		{
+			name:         "wav cut at pauses",
+			data:         testPCM.WAV(pcmSignal(testPCM, time.Minute, between(pauses...))),
+			opts:         chunked,
+			wantChunks:   4,
+			wantDuration: time.Minute,
+			unitDuration: pcmWindow,
+			pauses:       pauses,
+		},
+		{
+			name:         "wav over the byte limit",
+			data:         testPCM.WAV(pcmSignal(testPCM, 20*time.Second, nil)),
+			opts:         small,
+			wantChunks:   4,
+			wantDuration: 20 * time.Second,
+			unitDuration: pcmWindow,
+		},
+		{
+			name:         "wav shorter than one chunk",
+			data:         testPCM.WAV(pcmSignal(testPCM, 3*time.Second, nil)),
+			opts:         chunked,
+			wantChunks:   1,
+			wantDuration: 3 * time.Second,
+			unitDuration: pcmWindow,
+		},
+		{
+			name:         "wav with a truncated final frame",
+			data:         PCM{SampleRate: 8000, Channels: 2, BitsPerSample: 16}.WAV(append(pcmSignal(PCM{SampleRate: 8000, Channels: 2, BitsPerSample: 16}, 30*time.Second, nil), 1, 2)),
+			opts:         chunked,
+			wantChunks:   2,
+			wantDuration: 30 * time.Second,
+			unitDuration: pcmWindow,
+		},
+		{
+			name:         "cbr mp3 cut at pauses",
+			data:         mp3Stream(mp3Frames(time.Minute), cbr, between(pauses...)),
+			opts:         chunked,
+			wantChunks:   4,
+			wantDuration: time.Duration(mp3Frames(time.Minute)) * mp3FrameDuration,
+			unitDuration: mp3FrameDuration,
+			pauses:       pauses,
+		},
+		{
+			name:         "vbr mp3 with tag and xing frame cut at pauses",
+			data:         concat(id3Tag(1000), xingFrame(), mp3Stream(mp3Frames(time.Minute), vbr, between(pauses...))),
+			opts:         chunked,
+			wantChunks:   4,
+			wantDuration: time.Duration(mp3Frames(time.Minute)) * mp3FrameDuration,
+			unitDuration: mp3FrameDuration,
+			pauses:       pauses,
+		},
+		{
+			name:         "vbr mp3 over the byte limit",
+			data:         mp3Stream(mp3Frames(20*time.Second), vbr, nil),
+			opts:         small,
+			wantChunks:   5,
+			wantDuration: time.Duration(mp3Frames(20*time.Second)) * mp3FrameDuration,
+			unitDuration: mp3FrameDuration,
+		},
+		{
+			name:         "mp3 shorter than one chunk",
+			data:         mp3Stream(50, cbr, nil),
+			opts:         chunked,
+			wantChunks:   1,
+			wantDuration: 50 * mp3FrameDuration,
+			unitDuration: mp3FrameDuration,
+		},
+		{
+			name:         "mp3 with a truncated final frame",
+			data:         concat(mp3Stream(mp3Frames(30*time.Second), cbr, nil), mp3Frame(9, 1500)[:300]),
+			opts:         chunked,
+			wantChunks:   2,
+			wantDuration: time.Duration(mp3Frames(30*time.Second)) * mp3FrameDuration,
+			unitDuration: mp3FrameDuration,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := Split(tt.data, tt.opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != tt.wantChunks {
+				t.Fatalf("got %d chunks, want %d", len(chunks), tt.wantChunks)
+			}
+
+			source, units := decode(t, tt.data)
+			boundaries := make(map[int]bool, len(units)+1)
+			starts := make(map[time.Duration]unit, len(units))
+			for _, u := range units {
+				boundaries[u.offset] = true
+				starts[u.start] = u
+			}
+			last := units[len(units)-1]
+			boundaries[last.offset+last.size] = true
+
+			for i, c := range chunks {
+				if c.Index != i {
+					t.Errorf("chunk %d has index %d", i, c.Index)
+				}
+				if len(c.Data) > tt.opts.MaxChunkBytes || c.Duration > tt.opts.TargetDuration {
+					t.Errorf("chunk %d is %d bytes and %v long, over the limits", i, len(c.Data), c.Duration)
+				}
+
+				// Every chunk decodes on its own, into the audio of the
+				// source between two frame boundaries
+				data, chunkUnits := decode(t, c.Data)
+				if len(chunkUnits) == 0 || chunkUnits[0].offset != 0 {
+					t.Fatalf("chunk %d doesn't start with a frame", i)
+				}
+				var decoded time.Duration
+				for _, u := range chunkUnits {
+					decoded += u.dur
+				}
+				if decoded != c.Duration {
+					t.Errorf("chunk %d decodes to %v, says %v", i, decoded, c.Duration)
+				}
+				lastUnit := chunkUnits[len(chunkUnits)-1]
+				if lastUnit.offset+lastUnit.size != len(data) {
+					t.Errorf("chunk %d has %d bytes after its last frame", i, len(data)-lastUnit.offset-lastUnit.size)
+				}
+				audio := data[:lastUnit.offset+lastUnit.size]
+				first, ok := starts[c.Offset]
+				if !ok {
+					t.Fatalf("chunk %d starts at %v, not on a frame", i, c.Offset)
+				}
+				end := first.offset + len(audio)
+				if !boundaries[end] {
+					t.Errorf("chunk %d ends at byte %d, not on a frame", i, end)
+				}
+				if end > len(source) || !bytes.Equal(audio, source[first.offset:end]) {
+					t.Errorf("chunk %d doesn't hold the audio of the source at %v", i, c.Offset)
+				}
+
+				if i == 0 {
+					if c.Offset != 0 {
+						t.Errorf("first chunk starts at %v", c.Offset)
+					}
+					continue
+				}
+				prev := chunks[i-1]
+				cut := prev.Offset + prev.Duration
+				if overlap := cut - c.Offset; overlap > tt.opts.Overlap || overlap <= tt.opts.Overlap-tt.unitDuration {
+					t.Errorf("chunks %d and %d overlap by %v, want about %v", i-1, i, overlap, tt.opts.Overlap)
+				}
+				if tt.pauses != nil && !between(tt.pauses...)(cut-time.Nanosecond) {
+					t.Errorf("chunk %d is cut at %v, outside a pause", i-1, cut)
+				}
+			}
+
+			lastChunk := chunks[len(chunks)-1]
+			if end := lastChunk.Offset + lastChunk.Duration; end != tt.wantDuration {
+				t.Errorf("chunks end at %v, want %v", end, tt.wantDuration)
+			}
+		})
+	}
+}
+
+// decode parses a WAV or MP3 file, and returns its units along with the
+// bytes their offsets point into.
+func decode(t *testing.T, data []byte) ([]byte, []unit) {
+	t.Helper()
+	switch Detect(data) {
+	case FormatWAV:
+		wav, err := parseWAV(data)
+		if err != nil {
+			t.Fatalf("doesn't parse: %v", err)
+		}
+		return wav.data, wav.units()
+	case FormatMP3:
+		return data, mp3Units(data)
+	}
+	t.Fatal("unknown format")
+	return nil, nil
+}
+
+func TestSplitPassesOtherFormatsThrough(t *testing.T) {
+	ogg := append([]byte("OggS"), make([]byte, 100)...)
+	tests := []struct {
+		name    string
+		data    []byte
+		opts    Options
+		wantErr bool
+	}{
+		{"fits", ogg, DefaultOptions(), false},
+		{"too big", ogg, Options{MaxChunkBytes: 50, TargetDuration: time.Minute}, true},
+		{"invalid options", ogg, Options{}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			chunks, err := Split(tt.data, tt.opts)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(chunks) != 1 || chunks[0].Format != FormatOGG || !bytes.Equal(chunks[0].Data, ogg) {
+				t.Errorf("got %+v, want the file whole", chunks)
+			}
+		})
+	}
+}
@@ -0,0 +1,276 @@
+package audio
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	mpegVersion25 = 0
+	mpegVersion2  = 2
+	mpegVersion1  = 3
+
+	mpegLayer3 = 1
+	mpegLayer2 = 2
+	mpegLayer1 = 3
+)
+
+// Bitrates in kbps, indexed by [MPEG-1?][layer][bitrate index]
+var mp3Bitrates = [2][4][16]int{
+	// MPEG-2 and 2.5
+	{
+		{},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+	},
+	// MPEG-1
+	{
+		{},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+	},
+}
+
+var mp3SampleRates = [4][3]int{
+	mpegVersion25: {11025, 12000, 8000},
+	mpegVersion2:  {22050, 24000, 16000},
+	mpegVersion1:  {44100, 48000, 32000},
+}
+
+type mp3Header struct {
+	version    int
+	layer      int
+	crc        bool
+	mono       bool
+	sampleRate int
+	samples    int // samples per channel in this frame
+	size       int // size of the whole frame in bytes
+}
+
+// parseMP3Header decodes the 4-byte MPEG audio frame header at the start of b.
+func parseMP3Header(b []byte) (mp3Header, bool) {
+	if len(b) < 4 || b[0] != 0xFF || b[1]&0xE0 != 0xE0 {
+		return mp3Header{}, false
+	}
+
+	h := mp3Header{
+		version: int(b[1]>>3) & 3,
+		layer:   int(b[1]>>1) & 3,
+		crc:     b[1]&1 == 0,
+		mono:    b[3]>>6 == 3,
+	}
+	bitrateIndex := int(b[2] >> 4)
+	sampleRateIndex := int(b[2]>>2) & 3
+	padding := int(b[2]>>1) & 1
+
+	// Reserved values, and free-format streams we can't measure
+	if h.version == 1 || h.layer == 0 || bitrateIndex == 0 || bitrateIndex == 15 || sampleRateIndex == 3 {
+		return mp3Header{}, false
+	}
+
+	mpeg1 := 0
+	if h.version == mpegVersion1 {
+		mpeg1 = 1
+	}
+	bitrate := mp3Bitrates[mpeg1][h.layer][bitrateIndex] * 1000
+	h.sampleRate = mp3SampleRates[h.version][sampleRateIndex]
+
+	switch {
+	case h.layer == mpegLayer1:
+		h.samples = 384
+		h.size = (12*bitrate/h.sampleRate + padding) * 4
+	case h.layer == mpegLayer2 || h.version == mpegVersion1:
+		h.samples = 1152
+		h.size = 144*bitrate/h.sampleRate + padding
+	default: // layer III, MPEG-2/2.5
+		h.samples = 576
+		h.size = 72*bitrate/h.sampleRate + padding
+	}
+
+	return h, h.size > 4
+}
+
+// sideInfoSize is the length of the layer III side information that follows the header.
+func (h mp3Header) sideInfoSize() int {
+	switch {
+	case h.version == mpegVersion1 && h.mono:
+		return 17
+	case h.version == mpegVersion1:
+		return 32
+	case h.mono:
+		return 9
+	default:
+		return 17
+	}
+}
+
+// energy estimates how loud a layer III frame is without decoding it: the
+// number of bits the encoder spent on the spectrum (part2_3_length) is close
+// to zero for silence and grows with the signal. Other layers report 0.
+func (h mp3Header) energy(frame []byte) float64 {
+	if h.layer != mpegLayer3 {
+		return 0
+	}
+
+	start := 4
+	if h.crc {
+		start += 2
+	}
+	if start+h.sideInfoSize() > len(frame) {
+		return 0
+	}
+	r := bitReader{data: frame[start : start+h.sideInfoSize()]}
+
+	channels := 2
+	if h.mono {
+		channels = 1
+	}
+
+	granules := 1
+	if h.version == mpegVersion1 {
+		granules = 2
+		r.skip(9) // main_data_begin
+		if h.mono {
+			r.skip(5) // private_bits
+		} else {
+			r.skip(3)
+		}
+		r.skip(4 * channels) // scfsi
+	} else {
+		r.skip(8)
+		if h.mono {
+			r.skip(1)
+		} else {
+			r.skip(2)
+		}
+	}
+
+	var bits int
+	for gr := 0; gr < granules; gr++ {
+		for ch := 0; ch < channels; ch++ {
+			bits += r.read(12) // part2_3_length
+			if h.version == mpegVersion1 {
+				r.skip(59 - 12)
+			} else {
+				r.skip(63 - 12)
+			}
+		}
+	}
+	return float64(bits)
+}
+
+// isInfoFrame reports whether the frame is a Xing/Info/VBRI header. Those
+// frames describe the whole file and must not be copied into a chunk.
+func (h mp3Header) isInfoFrame(frame []byte) bool {
+	tag := 4 + h.sideInfoSize()
+	if h.crc {
+		tag += 2
+	}
+	if tag+4 <= len(frame) {
+		if s := string(frame[tag : tag+4]); s == "Xing" || s == "Info" {
+			return true
+		}
+	}
+	return len(frame) >= 40 && string(frame[36:40]) == "VBRI"
+}
+
+// id3Size returns the size of the ID3v2 tag at the start of data, if any.
+func id3Size(data []byte) int {
+	if len(data) < 10 || string(data[0:3]) != "ID3" {
+		return 0
+	}
+	// Synchsafe integer: 7 bits per byte
+	size := int(data[6])<<21 | int(data[7])<<14 | int(data[8])<<7 | int(data[9])
+	size += 10
+	if data[5]&0x10 != 0 { // footer present
+		size += 10
+	}
+	return size
+}
+
+// mp3Units walks the frames of an MP3 stream. After garbage (or at the very
+// start) a candidate header is only trusted if another frame follows it.
+func mp3Units(data []byte) []unit {
+	var units []unit
+	var elapsed time.Duration
+
+	pos := id3Size(data)
+	synced := false
+	for pos+4 <= len(data) {
+		h, ok := parseMP3Header(data[pos:])
+		if !ok || pos+h.size > len(data) {
+			pos++
+			synced = false
+			continue
+		}
+		if !synced && pos+h.size+4 <= len(data) {
+			if _, ok := parseMP3Header(data[pos+h.size:]); !ok {
+				pos++
+				continue
+			}
+		}
+		synced = true
+
+		frame := data[pos : pos+h.size]
+		if len(units) == 0 && h.isInfoFrame(frame) {
+			pos += h.size
+			continue
+		}
+
+		dur := time.Duration(h.samples) * time.Second / time.Duration(h.sampleRate)
+		units = append(units, unit{
+			offset: pos,
+			size:   h.size,
+			start:  elapsed,
+			dur:    dur,
+			energy: h.energy(frame),
+		})
+		elapsed += dur
+		pos += h.size
+	}
+	return units
+}
+
+func splitMP3(data []byte, opts Options) ([]Chunk, error) {
+	units := mp3Units(data)
+	if len(units) == 0 {
+		return nil, errors.New("no MPEG audio frames found")
+	}
+
+	chunks := make([]Chunk, 0)
+	for i, s := range plan(units, 0, opts) {
+		first, last := units[s.first], units[s.last-1]
+		chunks = append(chunks, Chunk{
+			Index:    i,
+			Format:   FormatMP3,
+			Data:     data[first.offset : last.offset+last.size],
+			Offset:   first.start,
+			Duration: last.start + last.dur - first.start,
+		})
+	}
+	return chunks, nil
+}
+
+// bitReader reads big-endian bit fields, returning zeros past the end.
+type bitReader struct {
+	data []byte
+	pos  int
+}
+
+func (r *bitReader) read(n int) int {
+	var v int
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if byteIndex := r.pos / 8; byteIndex < len(r.data) {
+			v |= int(r.data[byteIndex]>>(7-r.pos%8)) & 1
+		}
+		r.pos++
+	}
+	return v
+}
+
+func (r *bitReader) skip(n int) {
+	r.pos += n
+}
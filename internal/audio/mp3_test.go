@@ -0,0 +1,187 @@
+package audio
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+// mp3FrameDuration is the length of an MPEG-1 layer III frame at 44.1 kHz.
+const mp3FrameDuration = 1152 * time.Second / 44100
+
+// mp3Frame builds an MPEG-1 layer III mono frame at 44.1 kHz. The audio is
+// all zeros, only part2_3_length is set: bits is what energy reads back.
+func mp3Frame(bitrateIndex int, bits int) []byte {
+	h, ok := parseMP3Header([]byte{0xFF, 0xFB, byte(bitrateIndex << 4), 0xC0})
+	if !ok {
+		panic("invalid bitrate index")
+	}
+	frame := make([]byte, h.size)
+	copy(frame, []byte{0xFF, 0xFB, byte(bitrateIndex << 4), 0xC0})
+
+	// Side info: main_data_begin (9), private_bits (5), scfsi (4), then 59
+	// bits per granule starting with part2_3_length (12)
+	side := frame[4 : 4+h.sideInfoSize()]
+	setBits(side, 18, 12, bits)
+	setBits(side, 18+59, 12, bits)
+	return frame
+}
+
+// xingFrame builds the info frame VBR encoders put in front of the audio.
+func xingFrame() []byte {
+	frame := mp3Frame(9, 0)
+	copy(frame[4+17:], "Xing")
+	return frame
+}
+
+// id3Tag builds an empty ID3v2 tag with size bytes of padding.
+func id3Tag(size int) []byte {
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(size >> 21 & 0x7F), byte(size >> 14 & 0x7F), byte(size >> 7 & 0x7F), byte(size & 0x7F)}
+	return append(tag, make([]byte, size)...)
+}
+
+func setBits(b []byte, pos int, n int, v int) {
+	for i := 0; i < n; i++ {
+		bit := pos + i
+		if v>>(n-1-i)&1 == 1 {
+			b[bit/8] |= 0x80 >> (bit % 8)
+		} else {
+			b[bit/8] &^= 0x80 >> (bit % 8)
+		}
+	}
+}
+
+// mp3Stream concatenates count frames, with the bitrate picked by bitrate
+// and silence wherever quiet says so.
+func mp3Stream(count int, bitrate func(i int) int, quiet func(d time.Duration) bool) []byte {
+	var buf bytes.Buffer
+	for i := 0; i < count; i++ {
+		bits := 1500
+		if quiet != nil && quiet(time.Duration(i)*mp3FrameDuration) {
+			bits = 0
+		}
+		buf.Write(mp3Frame(bitrate(i), bits))
+	}
+	return buf.Bytes()
+}
+
+func cbr(int) int { return 9 } // 128 kbps
+
+func vbr(i int) int { return []int{5, 9, 14, 11, 7}[i%5] } // 64 to 320 kbps
+
+func TestParseMP3Header(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   []byte
+		wantOK   bool
+		wantSize int
+	}{
+		{"128 kbps", []byte{0xFF, 0xFB, 0x90, 0xC0}, true, 417},
+		{"128 kbps padded", []byte{0xFF, 0xFB, 0x92, 0xC0}, true, 418},
+		{"320 kbps", []byte{0xFF, 0xFB, 0xE0, 0x00}, true, 1044},
+		{"MPEG-2 64 kbps at 22.05 kHz", []byte{0xFF, 0xF3, 0x80, 0x00}, true, 208},
+		{"free format", []byte{0xFF, 0xFB, 0x00, 0xC0}, false, 0},
+		{"bad bitrate", []byte{0xFF, 0xFB, 0xF0, 0xC0}, false, 0},
+		{"reserved sample rate", []byte{0xFF, 0xFB, 0x9C, 0xC0}, false, 0},
+		{"no sync", []byte{0xFF, 0x1B, 0x90, 0xC0}, false, 0},
+		{"too short", []byte{0xFF, 0xFB}, false, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, ok := parseMP3Header(tt.header)
+			if ok != tt.wantOK {
+				t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && h.size != tt.wantSize {
+				t.Errorf("size = %d, want %d", h.size, tt.wantSize)
+			}
+		})
+	}
+}
+
+func TestMP3Units(t *testing.T) {
+	loud := mp3Frame(9, 1500)
+	tests := []struct {
+		name         string
+		data         []byte
+		wantUnits    int
+		wantOffset   int // of the first unit
+		wantEnd      int // of the last unit
+		wantEnergies []float64
+	}{
+		{
+			name:       "cbr",
+			data:       mp3Stream(10, cbr, nil),
+			wantUnits:  10,
+			wantOffset: 0,
+			wantEnd:    10 * len(loud),
+		},
+		{
+			name:         "vbr",
+			data:         mp3Stream(5, vbr, func(d time.Duration) bool { return d >= 2*mp3FrameDuration }),
+			wantUnits:    5,
+			wantOffset:   0,
+			wantEnd:      len(mp3Stream(5, vbr, nil)),
+			wantEnergies: []float64{3000, 3000, 0, 0, 0},
+		},
+		{
+			name:       "id3 tag and xing frame are skipped",
+			data:       concat(id3Tag(100), xingFrame(), mp3Stream(3, vbr, nil)),
+			wantUnits:  3,
+			wantOffset: 110 + len(xingFrame()),
+			wantEnd:    110 + len(xingFrame()) + len(mp3Stream(3, vbr, nil)),
+		},
+		{
+			name:       "garbage before the first frame",
+			data:       concat([]byte{0xFF, 0xFB, 0x90, 0x00, 0x12, 0xFF}, mp3Stream(3, cbr, nil)),
+			wantUnits:  3,
+			wantOffset: 6,
+			wantEnd:    6 + 3*len(loud),
+		},
+		{
+			name:       "truncated final frame",
+			data:       concat(mp3Stream(4, cbr, nil), loud[:200]),
+			wantUnits:  4,
+			wantOffset: 0,
+			wantEnd:    4 * len(loud),
+		},
+		{
+			name:      "no frames",
+			data:      make([]byte, 1000),
+			wantUnits: 0,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			units := mp3Units(tt.data)
+			if len(units) != tt.wantUnits {
+				t.Fatalf("got %d units, want %d", len(units), tt.wantUnits)
+			}
+			if len(units) == 0 {
+				return
+			}
+			if units[0].offset != tt.wantOffset {
+				t.Errorf("first unit at %d, want %d", units[0].offset, tt.wantOffset)
+			}
+			last := units[len(units)-1]
+			if end := last.offset + last.size; end != tt.wantEnd {
+				t.Errorf("last unit ends at %d, want %d", end, tt.wantEnd)
+			}
+			for i, u := range units {
+				if u.start != time.Duration(i)*mp3FrameDuration || u.dur != mp3FrameDuration {
+					t.Errorf("unit %d spans %v+%v, want %v+%v", i, u.start, u.dur, time.Duration(i)*mp3FrameDuration, mp3FrameDuration)
+				}
+				if i > 0 && u.offset != units[i-1].offset+units[i-1].size {
+					t.Errorf("unit %d at %d doesn't follow the one before", i, u.offset)
+				}
+				if tt.wantEnergies != nil && u.energy != tt.wantEnergies[i] {
+					t.Errorf("unit %d energy = %v, want %v", i, u.energy, tt.wantEnergies[i])
+				}
+			}
+		})
+	}
+}
+
+func concat(parts ...[]byte) []byte {
+	return bytes.Join(parts, nil)
+}
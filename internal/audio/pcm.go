@@ -0,0 +1,80 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"time"
+)
+
+// PCM describes raw interleaved little-endian integer PCM, like a microphone
+// streams it.
+type PCM struct {
+	SampleRate    int
+	Channels      int
+	BitsPerSample int
+}
+
+// Validate reports formats we can't wrap in a WAV file.
+func (p PCM) Validate() error {
+	switch {
+	case p.SampleRate < 8000 || p.SampleRate > 192000:
+		return fmt.Errorf("unsupported sample rate %d", p.SampleRate)
+	case p.Channels < 1 || p.Channels > 8:
+		return fmt.Errorf("unsupported channel count %d", p.Channels)
+	case p.BitsPerSample != 16 && p.BitsPerSample != 24 && p.BitsPerSample != 32:
+		return fmt.Errorf("unsupported sample size of %d bits", p.BitsPerSample)
+	}
+	return nil
+}
+
+// FrameSize is the number of bytes of one sample for every channel.
+func (p PCM) FrameSize() int {
+	return p.Channels * p.BitsPerSample / 8
+}
+
+// Bytes returns how many bytes of whole frames last d.
+func (p PCM) Bytes(d time.Duration) int {
+	return int(int64(d)*int64(p.SampleRate)/int64(time.Second)) * p.FrameSize()
+}
+
+// Duration returns how long n bytes of audio last.
+func (p PCM) Duration(n int) time.Duration {
+	return time.Duration(n/p.FrameSize()) * time.Second / time.Duration(p.SampleRate)
+}
+
+// WAV wraps pcm in a standalone WAV file.
+func (p PCM) WAV(pcm []byte) []byte {
+	wav := &wavFile{fmtChunk: p.fmtChunk()}
+	return wav.encode(pcm)
+}
+
+// StreamHeader returns the header of a WAV file whose length isn't known yet,
+// for writing the audio out as it comes in. The sizes are left at 0xFFFFFFFF,
+// as streaming writers do.
+func (p PCM) StreamHeader() []byte {
+	fmtChunk := p.fmtChunk()
+
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(fmtChunk)))
+	buf.Write(fmtChunk)
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xFFFFFFFF))
+	return buf.Bytes()
+}
+
+// fmtChunk is the body of the "fmt " chunk for plain PCM.
+func (p PCM) fmtChunk() []byte {
+	b := make([]byte, 16)
+	binary.LittleEndian.PutUint16(b[0:2], wavFormatPCM)
+	binary.LittleEndian.PutUint16(b[2:4], uint16(p.Channels))
+	binary.LittleEndian.PutUint32(b[4:8], uint32(p.SampleRate))
+	binary.LittleEndian.PutUint32(b[8:12], uint32(p.SampleRate*p.FrameSize()))
+	binary.LittleEndian.PutUint16(b[12:14], uint16(p.FrameSize()))
+	binary.LittleEndian.PutUint16(b[14:16], uint16(p.BitsPerSample))
+	return b
+}
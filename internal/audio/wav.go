@@ -0,0 +1,210 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"time"
+)
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xFFFE
+
+	wavHeaderSize = 12 + 8 + 8 // RIFF header, fmt and data chunk headers
+
+	// pcmWindow is the length of the pieces we measure energy over and cut between.
+	pcmWindow = 20 * time.Millisecond
+)
+
+type wavFile struct {
+	fmtChunk []byte // raw body of the "fmt " chunk, copied into every chunk we write
+
+	format        uint16
+	channels      int
+	sampleRate    int
+	blockAlign    int
+	bitsPerSample int
+
+	data []byte
+}
+
+func parseWAV(data []byte) (*wavFile, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, errors.New("not a RIFF/WAVE file")
+	}
+
+	wav := &wavFile{}
+	pos := 12
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		body := pos + 8
+		// Streaming writers leave the size at 0 or 0xFFFFFFFF, clamp to what we have
+		if size < 0 || body+size > len(data) || (id == "data" && size == 0) {
+			size = len(data) - body
+		}
+
+		switch id {
+		case "fmt ":
+			if size < 16 {
+				return nil, fmt.Errorf("fmt chunk is too short (%d bytes)", size)
+			}
+			wav.fmtChunk = data[body : body+size]
+			wav.format = binary.LittleEndian.Uint16(wav.fmtChunk[0:2])
+			wav.channels = int(binary.LittleEndian.Uint16(wav.fmtChunk[2:4]))
+			wav.sampleRate = int(binary.LittleEndian.Uint32(wav.fmtChunk[4:8]))
+			wav.blockAlign = int(binary.LittleEndian.Uint16(wav.fmtChunk[12:14]))
+			wav.bitsPerSample = int(binary.LittleEndian.Uint16(wav.fmtChunk[14:16]))
+			// WAVE_FORMAT_EXTENSIBLE keeps the real format at the start of the sub-format GUID
+			if wav.format == wavFormatExtensible && size >= 26 {
+				wav.format = binary.LittleEndian.Uint16(wav.fmtChunk[24:26])
+			}
+		case "data":
+			wav.data = data[body : body+size]
+		}
+
+		// Chunks are padded to an even size
+		pos = body + size + size%2
+	}
+
+	if wav.fmtChunk == nil {
+		return nil, errors.New("wav file has no fmt chunk")
+	}
+	if wav.data == nil {
+		return nil, errors.New("wav file has no data chunk")
+	}
+	if wav.sampleRate <= 0 || wav.blockAlign <= 0 || wav.channels <= 0 {
+		return nil, fmt.Errorf("invalid wav format: %d Hz, %d channels, block align %d", wav.sampleRate, wav.channels, wav.blockAlign)
+	}
+	return wav, nil
+}
+
+// units cuts the PCM data into pcmWindow-long pieces aligned to whole frames.
+func (wav *wavFile) units() []unit {
+	framesPerUnit := wav.sampleRate * int(pcmWindow) / int(time.Second)
+	if framesPerUnit < 1 {
+		framesPerUnit = 1
+	}
+	totalFrames := len(wav.data) / wav.blockAlign
+
+	units := make([]unit, 0, totalFrames/framesPerUnit+1)
+	for frame := 0; frame < totalFrames; frame += framesPerUnit {
+		frames := framesPerUnit
+		if frame+frames > totalFrames {
+			frames = totalFrames - frame
+		}
+		offset := frame * wav.blockAlign
+		units = append(units, unit{
+			offset: offset,
+			size:   frames * wav.blockAlign,
+			start:  wav.duration(frame),
+			dur:    wav.duration(frames),
+			energy: wav.energy(wav.data[offset : offset+frames*wav.blockAlign]),
+		})
+	}
+	return units
+}
+
+func (wav *wavFile) duration(frames int) time.Duration {
+	return time.Duration(frames) * time.Second / time.Duration(wav.sampleRate)
+}
+
+// energy returns the mean absolute amplitude of the samples in pcm, in [0, 1].
+// Formats we can't read (e.g. ADPCM) report 0, which makes us cut at the target length.
+func (wav *wavFile) energy(pcm []byte) float64 {
+	width := wav.bitsPerSample / 8
+	if width == 0 {
+		return 0
+	}
+
+	var sample func(b []byte) float64
+	switch {
+	case wav.format == wavFormatPCM && width == 1:
+		sample = func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }
+	case wav.format == wavFormatPCM && width == 2:
+		sample = func(b []byte) float64 { return float64(int16(binary.LittleEndian.Uint16(b))) / (1 << 15) }
+	case wav.format == wavFormatPCM && width == 3:
+		sample = func(b []byte) float64 {
+			v := int32(b[0]) | int32(b[1])<<8 | int32(int8(b[2]))<<16
+			return float64(v) / (1 << 23)
+		}
+	case wav.format == wavFormatPCM && width == 4:
+		sample = func(b []byte) float64 { return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31) }
+	case wav.format == wavFormatFloat && width == 4:
+		sample = func(b []byte) float64 { return float64(math.Float32frombits(binary.LittleEndian.Uint32(b))) }
+	case wav.format == wavFormatFloat && width == 8:
+		sample = func(b []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(b)) }
+	default:
+		return 0
+	}
+
+	var sum float64
+	var n int
+	for i := 0; i+width <= len(pcm); i += width {
+		sum += math.Abs(sample(pcm[i : i+width]))
+		n++
+	}
+	if n == 0 {
+		return 0
+	}
+	return sum / float64(n)
+}
+
+// encode writes pcm as a standalone WAV file with the original fmt chunk.
+func (wav *wavFile) encode(pcm []byte) []byte {
+	fmtSize := len(wav.fmtChunk) + len(wav.fmtChunk)%2
+	dataSize := len(pcm) + len(pcm)%2
+
+	var buf bytes.Buffer
+	buf.Grow(wavHeaderSize + fmtSize + dataSize)
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+8+fmtSize+8+dataSize))
+	buf.WriteString("WAVE")
+
+	buf.WriteString("fmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(wav.fmtChunk)))
+	buf.Write(wav.fmtChunk)
+	if len(wav.fmtChunk)%2 == 1 {
+		buf.WriteByte(0)
+	}
+
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(len(pcm)))
+	buf.Write(pcm)
+	if len(pcm)%2 == 1 {
+		buf.WriteByte(0)
+	}
+
+	return buf.Bytes()
+}
+
+func splitWAV(data []byte, opts Options) ([]Chunk, error) {
+	wav, err := parseWAV(data)
+	if err != nil {
+		return nil, err
+	}
+
+	units := wav.units()
+	if len(units) == 0 {
+		return nil, errors.New("wav file has no audio frames")
+	}
+
+	headerSize := wavHeaderSize + len(wav.fmtChunk) + 2
+	chunks := make([]Chunk, 0)
+	for i, s := range plan(units, headerSize, opts) {
+		first, last := units[s.first], units[s.last-1]
+		chunks = append(chunks, Chunk{
+			Index:    i,
+			Format:   FormatWAV,
+			Data:     wav.encode(wav.data[first.offset : last.offset+last.size]),
+			Offset:   first.start,
+			Duration: last.start + last.dur - first.start,
+		})
+	}
+	return chunks, nil
+}
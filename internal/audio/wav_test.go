@@ -0,0 +1,185 @@
+package audio
+
+import (
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// testPCM is 16-bit mono at 8 kHz: 16000 bytes a second, 160 frames a unit.
+var testPCM = PCM{SampleRate: 8000, Channels: 1, BitsPerSample: 16}
+
+// pcmSignal returns d of a square wave, silent wherever quiet says so.
+func pcmSignal(p PCM, d time.Duration, quiet func(d time.Duration) bool) []byte {
+	frames := p.Bytes(d) / p.FrameSize()
+	pcm := make([]byte, 0, frames*p.FrameSize())
+	for i := 0; i < frames; i++ {
+		v := int16(8000)
+		if i%2 == 1 {
+			v = -8000
+		}
+		if quiet != nil && quiet(time.Duration(i)*time.Second/time.Duration(p.SampleRate)) {
+			v = 0
+		}
+		for ch := 0; ch < p.Channels; ch++ {
+			pcm = binary.LittleEndian.AppendUint16(pcm, uint16(v))
+		}
+	}
+	return pcm
+}
+
+// riffChunk encodes one chunk of a RIFF file, declaring size as its length.
+func riffChunk(id string, size uint32, body []byte) []byte {
+	b := append([]byte(id), binary.LittleEndian.AppendUint32(nil, size)...)
+	b = append(b, body...)
+	if len(body)%2 == 1 {
+		b = append(b, 0)
+	}
+	return b
+}
+
+// riffFile wraps chunks in a RIFF/WAVE header.
+func riffFile(chunks ...[]byte) []byte {
+	body := concat(chunks...)
+	return concat([]byte("RIFF"), binary.LittleEndian.AppendUint32(nil, uint32(4+len(body))), []byte("WAVE"), body)
+}
+
+func TestParseWAV(t *testing.T) {
+	pcm := pcmSignal(testPCM, 100*time.Millisecond, nil)
+	fmtChunk := riffChunk("fmt ", 16, testPCM.fmtChunk())
+
+	extensible := make([]byte, 40)
+	copy(extensible, testPCM.fmtChunk())
+	binary.LittleEndian.PutUint16(extensible[0:2], wavFormatExtensible)
+	binary.LittleEndian.PutUint16(extensible[16:18], 22)
+	binary.LittleEndian.PutUint16(extensible[24:26], wavFormatPCM)
+
+	tests := []struct {
+		name       string
+		data       []byte
+		wantErr    bool
+		wantFormat uint16
+		wantData   int
+	}{
+		{
+			name:       "plain pcm",
+			data:       testPCM.WAV(pcm),
+			wantFormat: wavFormatPCM,
+			wantData:   len(pcm),
+		},
+		{
+			name:       "extensible",
+			data:       riffFile(riffChunk("fmt ", 40, extensible), riffChunk("data", uint32(len(pcm)), pcm)),
+			wantFormat: wavFormatPCM,
+			wantData:   len(pcm),
+		},
+		{
+			name:       "odd sized chunk before the data",
+			data:       riffFile(fmtChunk, riffChunk("LIST", 3, []byte("abc")), riffChunk("data", uint32(len(pcm)), pcm)),
+			wantFormat: wavFormatPCM,
+			wantData:   len(pcm),
+		},
+		{
+			name:       "streamed with unknown sizes",
+			data:       concat(testPCM.StreamHeader(), pcm),
+			wantFormat: wavFormatPCM,
+			wantData:   len(pcm),
+		},
+		{
+			name:       "streamed with a zero data size",
+			data:       riffFile(fmtChunk, riffChunk("data", 0, pcm)),
+			wantFormat: wavFormatPCM,
+			wantData:   len(pcm),
+		},
+		{
+			name:       "truncated data",
+			data:       riffFile(fmtChunk, riffChunk("data", uint32(len(pcm)), pcm[:1000])),
+			wantFormat: wavFormatPCM,
+			wantData:   1000,
+		},
+		{
+			name:    "not riff",
+			data:    []byte("RIFX\x00\x00\x00\x00WAVE"),
+			wantErr: true,
+		},
+		{
+			name:    "no fmt chunk",
+			data:    riffFile(riffChunk("data", uint32(len(pcm)), pcm)),
+			wantErr: true,
+		},
+		{
+			name:    "short fmt chunk",
+			data:    riffFile(riffChunk("fmt ", 14, testPCM.fmtChunk()[:14]), riffChunk("data", uint32(len(pcm)), pcm)),
+			wantErr: true,
+		},
+		{
+			name:    "no data chunk",
+			data:    riffFile(fmtChunk),
+			wantErr: true,
+		},
+		{
+			name:    "zero sample rate",
+			data:    PCM{SampleRate: 0, Channels: 1, BitsPerSample: 16}.WAV(pcm),
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wav, err := parseWAV(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if wav.format != tt.wantFormat {
+				t.Errorf("format = %d, want %d", wav.format, tt.wantFormat)
+			}
+			if len(wav.data) != tt.wantData {
+				t.Errorf("data is %d bytes, want %d", len(wav.data), tt.wantData)
+			}
+			if wav.sampleRate != testPCM.SampleRate || wav.channels != testPCM.Channels || wav.blockAlign != testPCM.FrameSize() {
+				t.Errorf("got %d Hz, %d channels, block align %d", wav.sampleRate, wav.channels, wav.blockAlign)
+			}
+		})
+	}
+}
+
+func TestWAVUnits(t *testing.T) {
+	tests := []struct {
+		name      string
+		pcm       []byte
+		wantUnits int
+		wantLast  time.Duration // duration of the last unit
+	}{
+		{"whole units", pcmSignal(testPCM, time.Second, nil), 50, pcmWindow},
+		{"short last unit", pcmSignal(testPCM, 1010*time.Millisecond, nil), 51, 10 * time.Millisecond},
+		{"truncated final frame", append(pcmSignal(testPCM, time.Second, nil), 0x12), 50, pcmWindow},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			wav, err := parseWAV(testPCM.WAV(tt.pcm))
+			if err != nil {
+				t.Fatal(err)
+			}
+			units := wav.units()
+			if len(units) != tt.wantUnits {
+				t.Fatalf("got %d units, want %d", len(units), tt.wantUnits)
+			}
+			if last := units[len(units)-1]; last.dur != tt.wantLast {
+				t.Errorf("last unit lasts %v, want %v", last.dur, tt.wantLast)
+			}
+			for i, u := range units {
+				if u.offset%testPCM.FrameSize() != 0 || u.size%testPCM.FrameSize() != 0 {
+					t.Errorf("unit %d (%d+%d) doesn't hold whole frames", i, u.offset, u.size)
+				}
+				if u.energy < 0.2 || u.energy > 0.3 {
+					t.Errorf("unit %d energy = %v, want about 0.24", i, u.energy)
+				}
+			}
+		})
+	}
+}
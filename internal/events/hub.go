@@ -0,0 +1,197 @@
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Event is one message of a recording's event stream. IDs only go up, so a
+// client that reconnects can ask for what it missed.
+type Event struct {
+	ID   int64
+	Type string
+	Data interface{}
+}
+
+const (
+	// subscriberBuffer is how many events a subscriber may fall behind before
+	// it is dropped. It reconnects and catches up from the history.
+	subscriberBuffer = 256
+	// defaultHistoryLimit caps the events kept per recording for late subscribers.
+	defaultHistoryLimit = 1000
+	// defaultRetention is how long the history of a finished run is kept.
+	defaultRetention = 10 * time.Minute
+)
+
+// Hub fans the events of every recording out to its subscribers, and keeps
+// the recent ones so a subscriber that comes late, or reconnects, sees the
+// run from the start.
+type Hub struct {
+	HistoryLimit int
+	Retention    time.Duration
+
+	mu     sync.Mutex
+	lastID int64
+	topics map[int]*topic
+}
+
+type topic struct {
+	history     []Event
+	subscribers map[chan Event]struct{}
+	expiry      *time.Timer
+}
+
+func NewHub() *Hub {
+	return &Hub{
+		HistoryLimit: defaultHistoryLimit,
+		Retention:    defaultRetention,
+		topics:       make(map[int]*topic),
+	}
+}
+
+// Publish sends an event to everybody following the recording and keeps it
+// for later subscribers.
+func (h *Hub) Publish(recordingId int, eventType string, data interface{}) {
+	h.publish(recordingId, eventType, data, true)
+}
+
+// PublishTransient sends an event that is only worth seeing live, like a
+// token of a summary being written, so it isn't kept.
+func (h *Hub) PublishTransient(recordingId int, eventType string, data interface{}) {
+	h.publish(recordingId, eventType, data, false)
+}
+
+func (h *Hub) publish(recordingId int, eventType string, data interface{}, keep bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(recordingId)
+	// A new run on a finished recording keeps its history alive
+	if t.expiry != nil {
+		t.expiry.Stop()
+		t.expiry = nil
+	}
+	h.lastID++
+	event := Event{ID: h.lastID, Type: eventType, Data: data}
+
+	if keep {
+		t.history = append(t.history, event)
+		if over := len(t.history) - h.HistoryLimit; h.HistoryLimit > 0 && over > 0 {
+			t.history = append([]Event(nil), t.history[over:]...)
+		}
+	}
+
+	for ch := range t.subscribers {
+		select {
+		case ch <- event:
+		default:
+			// Too slow, let it reconnect and replay instead of blocking the run
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+	}
+}
+
+// Subscribe follows the recording's events, starting with the kept ones that
+// come after lastId (0 for all of them). The channel is closed when the run
+// finishes, right away after the replay if it already has, or when the
+// subscriber falls too far behind; call cancel once done.
+func (h *Hub) Subscribe(recordingId int, lastId int64) (<-chan Event, func()) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t := h.topic(recordingId)
+	ch := make(chan Event, subscriberBuffer+len(t.history))
+	for _, event := range t.history {
+		if event.ID > lastId {
+			ch <- event
+		}
+	}
+	if t.expiry != nil {
+		close(ch)
+		return ch, func() {}
+	}
+	t.subscribers[ch] = struct{}{}
+
+	cancel := func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		if _, ok := t.subscribers[ch]; ok {
+			delete(t.subscribers, ch)
+			close(ch)
+		}
+		h.drop(recordingId, t)
+	}
+	return ch, cancel
+}
+
+// Replay returns the kept events of the recording after lastId on a channel
+// that is already closed, for recordings nothing runs on.
+func (h *Hub) Replay(recordingId int, lastId int64) <-chan Event {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	var history []Event
+	if t, ok := h.topics[recordingId]; ok {
+		history = t.history
+	}
+	ch := make(chan Event, len(history))
+	for _, event := range history {
+		if event.ID > lastId {
+			ch <- event
+		}
+	}
+	close(ch)
+	return ch
+}
+
+// Finish marks the end of a run on the recording and closes the channels of
+// its subscribers once they have the events so far. Its history is dropped
+// after Retention unless another run starts.
+func (h *Hub) Finish(recordingId int) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	t, ok := h.topics[recordingId]
+	if !ok {
+		return
+	}
+	for ch := range t.subscribers {
+		delete(t.subscribers, ch)
+		close(ch)
+	}
+	if t.expiry != nil {
+		t.expiry.Stop()
+	}
+	var expiry *time.Timer
+	expiry = time.AfterFunc(h.Retention, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+		// A run that started meanwhile stopped (or replaced) this timer too late
+		if t.expiry != expiry {
+			return
+		}
+		t.history = nil
+		t.expiry = nil
+		h.drop(recordingId, t)
+	})
+	t.expiry = expiry
+}
+
+// topic returns the recording's topic, creating it. h.mu must be held.
+func (h *Hub) topic(recordingId int) *topic {
+	t, ok := h.topics[recordingId]
+	if !ok {
+		t = &topic{subscribers: make(map[chan Event]struct{})}
+		h.topics[recordingId] = t
+	}
+	return t
+}
+
+// drop forgets the topic once nobody listens and there is nothing to replay.
+// h.mu must be held.
+func (h *Hub) drop(recordingId int, t *topic) {
+	if h.topics[recordingId] == t && len(t.subscribers) == 0 && len(t.history) == 0 {
+		delete(h.topics, recordingId)
+	}
+}
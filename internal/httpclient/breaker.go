@@ -0,0 +1,188 @@
+package httpclient
+
+import (
+	"errors"
+	"sort"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is returned without calling the provider while its breaker is open.
+var ErrCircuitOpen = errors.New("circuit breaker is open")
+
+// States of a Breaker
+const (
+	StateClosed   = "closed"
+	StateOpen     = "open"
+	StateHalfOpen = "half-open"
+)
+
+// Breaker stops calls to a provider after FailureThreshold failures in a row.
+// Once OpenTimeout has passed it lets a single probe through (half-open): a
+// success closes it again, a failure opens it for another OpenTimeout.
+type Breaker struct {
+	Name             string
+	FailureThreshold int
+	OpenTimeout      time.Duration
+
+	mu        sync.Mutex
+	state     string
+	failures  int
+	openedAt  time.Time
+	probing   bool
+	lastError string
+	lastFail  time.Time
+}
+
+// BreakerStatus is a snapshot of a Breaker.
+type BreakerStatus struct {
+	Name                string     `json:"name"`
+	State               string     `json:"state"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	OpenedAt            *time.Time `json:"opened_at,omitempty"`
+	RetryAt             *time.Time `json:"retry_at,omitempty"`
+	LastError           string     `json:"last_error,omitempty"`
+	LastFailureAt       *time.Time `json:"last_failure_at,omitempty"`
+}
+
+func NewBreaker(name string, failureThreshold int, openTimeout time.Duration) *Breaker {
+	if failureThreshold < 1 {
+		failureThreshold = 1
+	}
+	return &Breaker{Name: name, FailureThreshold: failureThreshold, OpenTimeout: openTimeout, state: StateClosed}
+}
+
+// Allow reports whether a call may go through now. Every allowed call must be
+// followed by Success, Failure or Release.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case StateOpen:
+		if time.Since(b.openedAt) < b.OpenTimeout {
+			return ErrCircuitOpen
+		}
+		b.state = StateHalfOpen
+		b.probing = true
+		return nil
+	case StateHalfOpen:
+		// Only one probe at a time
+		if b.probing {
+			return ErrCircuitOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+func (b *Breaker) Success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.state = StateClosed
+	b.failures = 0
+	b.probing = false
+}
+
+func (b *Breaker) Failure(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	b.probing = false
+	b.lastFail = time.Now()
+	if err != nil {
+		b.lastError = err.Error()
+	}
+	if b.state == StateHalfOpen || b.failures >= b.FailureThreshold {
+		b.state = StateOpen
+		b.openedAt = time.Now()
+	}
+}
+
+// Release ends an allowed call without a verdict, e.g. when the caller gave up.
+func (b *Breaker) Release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.probing = false
+}
+
+func (b *Breaker) Status() BreakerStatus {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	status := BreakerStatus{
+		Name:                b.Name,
+		State:               b.state,
+		ConsecutiveFailures: b.failures,
+		LastError:           b.lastError,
+	}
+	if b.state != StateClosed {
+		openedAt := b.openedAt
+		retryAt := b.openedAt.Add(b.OpenTimeout)
+		status.OpenedAt = &openedAt
+		status.RetryAt = &retryAt
+	}
+	if !b.lastFail.IsZero() {
+		lastFail := b.lastFail
+		status.LastFailureAt = &lastFail
+	}
+	return status
+}
+
+// Registry keeps one Breaker per provider, so every client of a provider
+// shares its state.
+type Registry struct {
+	mu       sync.Mutex
+	breakers map[string]*Breaker
+}
+
+// Breakers is the registry the provider clients use.
+var Breakers = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{breakers: make(map[string]*Breaker)}
+}
+
+// Breaker returns the provider's breaker, creating it the first time. The
+// given settings replace the old ones, the state is kept.
+func (r *Registry) Breaker(name string, failureThreshold int, openTimeout time.Duration) *Breaker {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	b, ok := r.breakers[name]
+	if !ok {
+		b = NewBreaker(name, failureThreshold, openTimeout)
+		r.breakers[name] = b
+		return b
+	}
+
+	b.mu.Lock()
+	if failureThreshold >= 1 {
+		b.FailureThreshold = failureThreshold
+	}
+	b.OpenTimeout = openTimeout
+	b.mu.Unlock()
+	return b
+}
+
+// Statuses returns the state of every breaker, sorted by provider name.
+func (r *Registry) Statuses() []BreakerStatus {
+	r.mu.Lock()
+	breakers := make([]*Breaker, 0, len(r.breakers))
+	for _, b := range r.breakers {
+		breakers = append(breakers, b)
+	}
+	r.mu.Unlock()
+
+	statuses := make([]BreakerStatus, 0, len(breakers))
+	for _, b := range breakers {
+		statuses = append(statuses, b.Status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+	return statuses
+}
@@ -0,0 +1,146 @@
+package httpclient
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestBreaker(t *testing.T) {
+	const openTimeout = 20 * time.Millisecond
+
+	// Steps run in order on one breaker with a threshold of 2
+	type step struct {
+		do        string // allow, success, failure, release or wait
+		wantErr   error  // of allow
+		wantState string
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "opens after the threshold",
+			steps: []step{
+				{do: "allow", wantState: StateClosed},
+				{do: "failure", wantState: StateClosed},
+				{do: "allow", wantState: StateClosed},
+				{do: "failure", wantState: StateOpen},
+				{do: "allow", wantErr: ErrCircuitOpen, wantState: StateOpen},
+			},
+		},
+		{
+			name: "success resets the count",
+			steps: []step{
+				{do: "allow"},
+				{do: "failure", wantState: StateClosed},
+				{do: "allow"},
+				{do: "success", wantState: StateClosed},
+				{do: "allow"},
+				{do: "failure", wantState: StateClosed},
+			},
+		},
+		{
+			name: "half-open probe that succeeds closes it",
+			steps: []step{
+				{do: "allow"}, {do: "failure"}, {do: "allow"}, {do: "failure", wantState: StateOpen},
+				{do: "wait"},
+				{do: "allow", wantState: StateHalfOpen},
+				{do: "allow", wantErr: ErrCircuitOpen, wantState: StateHalfOpen},
+				{do: "success", wantState: StateClosed},
+				{do: "allow", wantState: StateClosed},
+			},
+		},
+		{
+			name: "half-open probe that fails opens it again",
+			steps: []step{
+				{do: "allow"}, {do: "failure"}, {do: "allow"}, {do: "failure", wantState: StateOpen},
+				{do: "wait"},
+				{do: "allow", wantState: StateHalfOpen},
+				{do: "failure", wantState: StateOpen},
+				{do: "allow", wantErr: ErrCircuitOpen, wantState: StateOpen},
+				{do: "wait"},
+				{do: "allow", wantState: StateHalfOpen},
+			},
+		},
+		{
+			name: "released probe lets the next one in",
+			steps: []step{
+				{do: "allow"}, {do: "failure"}, {do: "allow"}, {do: "failure", wantState: StateOpen},
+				{do: "wait"},
+				{do: "allow", wantState: StateHalfOpen},
+				{do: "release", wantState: StateHalfOpen},
+				{do: "allow", wantState: StateHalfOpen},
+				{do: "allow", wantErr: ErrCircuitOpen, wantState: StateHalfOpen},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", 2, openTimeout)
+			for i, s := range tt.steps {
+				switch s.do {
+				case "allow":
+					if err := b.Allow(); !errors.Is(err, s.wantErr) {
+						t.Fatalf("step %d: Allow() = %v, want %v", i, err, s.wantErr)
+					}
+				case "success":
+					b.Success()
+				case "failure":
+					b.Failure(errors.New("status 503"))
+				case "release":
+					b.Release()
+				case "wait":
+					time.Sleep(openTimeout + 5*time.Millisecond)
+				}
+				if s.wantState != "" {
+					if state := b.Status().State; state != s.wantState {
+						t.Fatalf("step %d (%s): state = %s, want %s", i, s.do, state, s.wantState)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerStatus(t *testing.T) {
+	b := NewBreaker("lemonfox", 1, time.Minute)
+	if status := b.Status(); status.State != StateClosed || status.OpenedAt != nil || status.LastFailureAt != nil {
+		t.Fatalf("new breaker status = %+v", status)
+	}
+
+	b.Failure(errors.New("status 502"))
+	status := b.Status()
+	if status.State != StateOpen || status.ConsecutiveFailures != 1 || status.LastError != "status 502" {
+		t.Fatalf("status = %+v", status)
+	}
+	if status.OpenedAt == nil || status.RetryAt == nil || status.RetryAt.Sub(*status.OpenedAt) != time.Minute {
+		t.Errorf("opened at %v, retry at %v", status.OpenedAt, status.RetryAt)
+	}
+	if status.LastFailureAt == nil {
+		t.Error("no last failure time")
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	r := NewRegistry()
+	b := r.Breaker("openai", 3, time.Second)
+	b.Failure(nil)
+
+	again := r.Breaker("openai", 5, time.Minute)
+	if again != b {
+		t.Fatal("the provider got a second breaker")
+	}
+	if again.FailureThreshold != 5 || again.OpenTimeout != time.Minute {
+		t.Errorf("settings weren't replaced: %d, %v", again.FailureThreshold, again.OpenTimeout)
+	}
+	if again.Status().ConsecutiveFailures != 1 {
+		t.Error("state wasn't kept")
+	}
+
+	r.Breaker("lemonfox", 3, time.Second)
+	statuses := r.Statuses()
+	if len(statuses) != 2 || statuses[0].Name != "lemonfox" || statuses[1].Name != "openai" {
+		t.Errorf("statuses = %+v", statuses)
+	}
+}
@@ -0,0 +1,240 @@
+package httpclient
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Options configures a Client.
+type Options struct {
+	// Timeout limits every attempt, including reading the response body.
+	Timeout time.Duration
+	// MaxRetries is how many times a failed call is repeated.
+	MaxRetries int
+	// BaseDelay and MaxDelay bound the jittered exponential backoff.
+	BaseDelay time.Duration
+	MaxDelay  time.Duration
+	// MaxRetryAfter is the longest Retry-After we wait for. A provider asking
+	// for more fails the call straight away.
+	MaxRetryAfter time.Duration
+	// FailureThreshold and OpenTimeout configure the provider's Breaker.
+	FailureThreshold int
+	OpenTimeout      time.Duration
+}
+
+func DefaultOptions() Options {
+	return Options{
+		Timeout:          5 * time.Minute,
+		MaxRetries:       3,
+		BaseDelay:        500 * time.Millisecond,
+		MaxDelay:         30 * time.Second,
+		MaxRetryAfter:    time.Minute,
+		FailureThreshold: 5,
+		OpenTimeout:      30 * time.Second,
+	}
+}
+
+// Client sends requests to one provider with per-attempt timeouts, retries and
+// the provider's circuit breaker.
+type Client struct {
+	Name    string
+	Options Options
+	// Idempotent lets POST requests be retried too. Set it for providers where
+	// repeating a call has no side effects, like transcription and chat APIs.
+	Idempotent bool
+	HTTP       *http.Client
+	Breaker    *Breaker
+}
+
+// New returns a client for the named provider using its breaker in Breakers.
+func New(name string, opts Options) *Client {
+	return &Client{
+		Name:    name,
+		Options: opts,
+		HTTP:    &http.Client{},
+		Breaker: Breakers.Breaker(name, opts.FailureThreshold, opts.OpenTimeout),
+	}
+}
+
+// Do sends req, retrying transport errors, 408, 429 and 5xx responses with
+// jittered exponential backoff or after the provider's Retry-After. The body
+// of the returned response is already read into memory, so the per-attempt
+// timeout can't cut it off. Requests with a body are only retried when
+// req.GetBody is set, which http.NewRequest does for in-memory bodies.
+func (c *Client) Do(req *http.Request) (*http.Response, error) {
+	return c.send(req, false)
+}
+
+// Stream sends req like Do, but returns as soon as the response headers are
+// in, for bodies that are read as they arrive (server-sent events, NDJSON).
+// Timeout then limits the whole stream, which ends when the body is closed.
+// Only failures before the body is handed out count against the breaker.
+func (c *Client) Stream(req *http.Request) (*http.Response, error) {
+	return c.send(req, true)
+}
+
+func (c *Client) send(req *http.Request, stream bool) (*http.Response, error) {
+	ctx := req.Context()
+
+	// The breaker counts calls, not attempts: a call that needed retries
+	// but got through is a success, one that ran out of them a single failure
+	if err := c.Breaker.Allow(); err != nil {
+		return nil, fmt.Errorf("%s: %w", c.Name, err)
+	}
+
+	for attempt := 0; ; attempt++ {
+		resp, err := c.attempt(ctx, req, attempt, stream)
+		// The caller gave up, that says nothing about the provider
+		if ctx.Err() != nil {
+			c.Breaker.Release()
+			if resp != nil {
+				resp.Body.Close()
+			}
+			return nil, ctx.Err()
+		}
+
+		retryable := err != nil || isRetryableStatus(resp.StatusCode)
+		if !retryable {
+			c.Breaker.Success()
+			return resp, nil
+		}
+
+		wait, ok := c.backoff(resp, attempt)
+		if attempt >= c.Options.MaxRetries || !c.canRetry(req) || !ok {
+			if err != nil {
+				c.Breaker.Failure(err)
+			} else {
+				c.Breaker.Failure(fmt.Errorf("status %d", resp.StatusCode))
+			}
+			return resp, err
+		}
+		if resp != nil {
+			resp.Body.Close()
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			c.Breaker.Release()
+			return nil, ctx.Err()
+		case <-timer.C:
+		}
+	}
+}
+
+// attempt sends one copy of req. Unless stream is set it reads the whole
+// response.
+func (c *Client) attempt(ctx context.Context, req *http.Request, attempt int, stream bool) (*http.Response, error) {
+	cancel := context.CancelFunc(func() {})
+	if c.Options.Timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, c.Options.Timeout)
+	}
+
+	out := req.Clone(ctx)
+	if attempt > 0 && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		out.Body = body
+	}
+
+	resp, err := c.HTTP.Do(out)
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	if stream {
+		resp.Body = &cancelOnClose{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	}
+	defer cancel()
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = io.NopCloser(bytes.NewReader(body))
+	return resp, nil
+}
+
+// cancelOnClose ends the attempt's timeout along with the streamed body.
+type cancelOnClose struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelOnClose) Close() error {
+	err := b.ReadCloser.Close()
+	b.cancel()
+	return err
+}
+
+func (c *Client) canRetry(req *http.Request) bool {
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return c.Idempotent
+}
+
+// backoff returns how long to wait before the next attempt, and false if the
+// provider asked us to wait longer than MaxRetryAfter.
+func (c *Client) backoff(resp *http.Response, attempt int) (time.Duration, bool) {
+	if resp != nil {
+		if wait, ok := retryAfter(resp.Header.Get("Retry-After")); ok {
+			return wait, wait <= c.Options.MaxRetryAfter
+		}
+	}
+
+	// Full jitter: anywhere between 0 and the exponential delay
+	delay := c.Options.BaseDelay << attempt
+	if delay <= 0 || delay > c.Options.MaxDelay {
+		delay = c.Options.MaxDelay
+	}
+	if delay <= 0 {
+		return 0, true
+	}
+	return time.Duration(rand.Int63n(int64(delay))), true
+}
+
+// retryAfter parses a Retry-After header, either in seconds or an HTTP date.
+func retryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if at, err := http.ParseTime(value); err == nil {
+		wait := time.Until(at)
+		if wait < 0 {
+			wait = 0
+		}
+		return wait, true
+	}
+	return 0, false
+}
+
+func isRetryableStatus(status int) bool {
+	switch {
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests:
+		return true
+	case status == http.StatusNotImplemented:
+		return false
+	default:
+		return status >= 500
+	}
+}
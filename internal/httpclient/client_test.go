@@ -0,0 +1,417 @@
+package httpclient
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// reply is what the test server answers to one attempt.
+type reply struct {
+	status     int
+	retryAfter string
+	delay      time.Duration // before the headers
+	bodyDelay  time.Duration // between the headers and the body
+}
+
+// scriptedServer answers the n-th request with replies[n], and the last reply
+// to any after that. It records the body of every request.
+type scriptedServer struct {
+	*httptest.Server
+
+	mu      sync.Mutex
+	replies []reply
+	bodies  []string
+}
+
+func newScriptedServer(t *testing.T, replies ...reply) *scriptedServer {
+	s := &scriptedServer{replies: replies}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		s.mu.Lock()
+		n := len(s.bodies)
+		s.bodies = append(s.bodies, string(body))
+		s.mu.Unlock()
+
+		rep := s.replies[min(n, len(s.replies)-1)]
+		if !sleep(r.Context(), rep.delay) {
+			return
+		}
+		if rep.retryAfter != "" {
+			w.Header().Set("Retry-After", rep.retryAfter)
+		}
+		w.WriteHeader(rep.status)
+		if rep.bodyDelay > 0 {
+			w.(http.Flusher).Flush()
+			if !sleep(r.Context(), rep.bodyDelay) {
+				return
+			}
+		}
+		io.WriteString(w, http.StatusText(rep.status))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *scriptedServer) attempts() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.bodies)
+}
+
+func sleep(ctx context.Context, d time.Duration) bool {
+	select {
+	case <-time.After(d):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+func testOptions() Options {
+	return Options{
+		Timeout:          100 * time.Millisecond,
+		MaxRetries:       2,
+		BaseDelay:        time.Millisecond,
+		MaxDelay:         5 * time.Millisecond,
+		MaxRetryAfter:    2 * time.Second,
+		FailureThreshold: 3,
+		OpenTimeout:      50 * time.Millisecond,
+	}
+}
+
+func testClient(s *scriptedServer, opts Options) *Client {
+	return &Client{
+		Name:    "test",
+		Options: opts,
+		HTTP:    s.Client(),
+		Breaker: NewBreaker("test", opts.FailureThreshold, opts.OpenTimeout),
+	}
+}
+
+func TestClientDo(t *testing.T) {
+	slow := 500 * time.Millisecond
+
+	tests := []struct {
+		name         string
+		replies      []reply
+		method       string
+		idempotent   bool
+		wantStatus   int
+		wantErr      bool
+		wantAttempts int
+		wantMinTime  time.Duration
+		wantFailures int // counted by the breaker
+	}{
+		{
+			name:         "success",
+			replies:      []reply{{status: 200}},
+			wantStatus:   200,
+			wantAttempts: 1,
+		},
+		{
+			name:         "429 is retried",
+			replies:      []reply{{status: 429}, {status: 200}},
+			wantStatus:   200,
+			wantAttempts: 2,
+		},
+		{
+			name:         "5xx are retried",
+			replies:      []reply{{status: 503}, {status: 502}, {status: 200}},
+			wantStatus:   200,
+			wantAttempts: 3,
+		},
+		{
+			name:         "out of retries",
+			replies:      []reply{{status: 500}},
+			wantStatus:   500,
+			wantAttempts: 3,
+			wantFailures: 1,
+		},
+		{
+			name:         "501 is not retried",
+			replies:      []reply{{status: 501}, {status: 200}},
+			wantStatus:   501,
+			wantAttempts: 1,
+		},
+		{
+			name:         "4xx is not retried",
+			replies:      []reply{{status: 400}, {status: 200}},
+			wantStatus:   400,
+			wantAttempts: 1,
+		},
+		{
+			name:         "Retry-After in seconds is waited for",
+			replies:      []reply{{status: 429, retryAfter: "1"}, {status: 200}},
+			wantStatus:   200,
+			wantAttempts: 2,
+			wantMinTime:  time.Second,
+		},
+		{
+			name:         "Retry-After over the limit fails right away",
+			replies:      []reply{{status: 429, retryAfter: "3600"}, {status: 200}},
+			wantStatus:   429,
+			wantAttempts: 1,
+			wantFailures: 1,
+		},
+		{
+			name:         "slow response times out and is retried",
+			replies:      []reply{{status: 200, delay: slow}, {status: 200}},
+			wantStatus:   200,
+			wantAttempts: 2,
+		},
+		{
+			name:         "slow body times out and is retried",
+			replies:      []reply{{status: 200, bodyDelay: slow}, {status: 200}},
+			wantStatus:   200,
+			wantAttempts: 2,
+		},
+		{
+			name:         "every attempt too slow",
+			replies:      []reply{{status: 200, delay: slow}},
+			wantErr:      true,
+			wantAttempts: 3,
+			wantFailures: 1,
+		},
+		{
+			name:         "POST isn't retried",
+			replies:      []reply{{status: 503}, {status: 200}},
+			method:       http.MethodPost,
+			wantStatus:   503,
+			wantAttempts: 1,
+			wantFailures: 1,
+		},
+		{
+			name:         "POST to an idempotent provider is retried",
+			replies:      []reply{{status: 503}, {status: 200}},
+			method:       http.MethodPost,
+			idempotent:   true,
+			wantStatus:   200,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newScriptedServer(t, tt.replies...)
+			c := testClient(s, testOptions())
+			c.Idempotent = tt.idempotent
+
+			method := tt.method
+			if method == "" {
+				method = http.MethodGet
+			}
+			var body io.Reader
+			if method == http.MethodPost {
+				body = strings.NewReader("audio")
+			}
+			req, err := http.NewRequest(method, s.URL, body)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			started := time.Now()
+			resp, err := c.Do(req)
+			elapsed := time.Since(started)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got status %d", resp.StatusCode)
+				}
+			} else {
+				if err != nil {
+					t.Fatal(err)
+				}
+				if resp.StatusCode != tt.wantStatus {
+					t.Errorf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+				}
+				// The body was read within the attempt and is still there
+				got, err := io.ReadAll(resp.Body)
+				if err != nil || string(got) != http.StatusText(tt.wantStatus) {
+					t.Errorf("body = %q, %v", got, err)
+				}
+			}
+
+			if n := s.attempts(); n != tt.wantAttempts {
+				t.Errorf("%d attempts, want %d", n, tt.wantAttempts)
+			}
+			if elapsed < tt.wantMinTime {
+				t.Errorf("returned after %v, want at least %v", elapsed, tt.wantMinTime)
+			}
+			if f := c.Breaker.Status().ConsecutiveFailures; f != tt.wantFailures {
+				t.Errorf("breaker counted %d failures, want %d", f, tt.wantFailures)
+			}
+			if method == http.MethodPost {
+				for i, b := range s.bodies {
+					if b != "audio" {
+						t.Errorf("attempt %d sent body %q", i, b)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestClientStream(t *testing.T) {
+	s := newScriptedServer(t, reply{status: 503}, reply{status: 200, bodyDelay: 20 * time.Millisecond})
+	c := testClient(s, testOptions())
+
+	req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+	resp, err := c.Stream(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	// The headers are handed out before the body arrives
+	body, err := io.ReadAll(resp.Body)
+	if err != nil || string(body) != "OK" {
+		t.Errorf("body = %q, %v", body, err)
+	}
+	if n := s.attempts(); n != 2 {
+		t.Errorf("%d attempts, want 2", n)
+	}
+}
+
+func TestClientCancelledDuringBackoff(t *testing.T) {
+	s := newScriptedServer(t, reply{status: 429, retryAfter: "1"}, reply{status: 200})
+	c := testClient(s, testOptions())
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	req, _ := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if _, err := c.Do(req); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("err = %v, want the context's", err)
+	}
+	if n := s.attempts(); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+	// The caller gave up, that isn't the provider's fault
+	if status := c.Breaker.Status(); status.ConsecutiveFailures != 0 || status.State != StateClosed {
+		t.Errorf("breaker = %+v", status)
+	}
+}
+
+func TestClientBreaker(t *testing.T) {
+	opts := testOptions()
+	opts.MaxRetries = 0
+	opts.FailureThreshold = 2
+	s := newScriptedServer(t, reply{status: 500}, reply{status: 500}, reply{status: 500}, reply{status: 200})
+	c := testClient(s, opts)
+
+	get := func() (*http.Response, error) {
+		req, _ := http.NewRequest(http.MethodGet, s.URL, nil)
+		return c.Do(req)
+	}
+
+	// Two failed calls open the breaker, the next one doesn't reach the provider
+	get()
+	get()
+	if _, err := get(); !errors.Is(err, ErrCircuitOpen) {
+		t.Fatalf("err = %v, want ErrCircuitOpen", err)
+	}
+	if n := s.attempts(); n != 2 {
+		t.Fatalf("%d attempts, want 2", n)
+	}
+
+	// After OpenTimeout one probe goes through, and fails
+	time.Sleep(opts.OpenTimeout)
+	if resp, err := get(); err != nil || resp.StatusCode != 500 {
+		t.Fatalf("probe = %v, %v", resp, err)
+	}
+	if state := c.Breaker.Status().State; state != StateOpen {
+		t.Fatalf("state = %s after a failed probe, want open", state)
+	}
+
+	// The next probe succeeds and closes it
+	time.Sleep(opts.OpenTimeout)
+	if resp, err := get(); err != nil || resp.StatusCode != 200 {
+		t.Fatalf("probe = %v, %v", resp, err)
+	}
+	if status := c.Breaker.Status(); status.State != StateClosed || status.ConsecutiveFailures != 0 {
+		t.Errorf("breaker = %+v after a successful probe", status)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	c := &Client{Options: Options{BaseDelay: 10 * time.Millisecond, MaxDelay: 50 * time.Millisecond, MaxRetryAfter: time.Minute}}
+
+	tests := []struct {
+		name       string
+		retryAfter string
+		attempt    int
+		wantMax    time.Duration // exclusive, jittered below it
+		wantExact  time.Duration // for Retry-After
+		wantOK     bool
+	}{
+		{name: "first retry", attempt: 0, wantMax: 10 * time.Millisecond, wantOK: true},
+		{name: "grows exponentially", attempt: 2, wantMax: 40 * time.Millisecond, wantOK: true},
+		{name: "capped at MaxDelay", attempt: 5, wantMax: 50 * time.Millisecond, wantOK: true},
+		{name: "shift overflow is capped", attempt: 70, wantMax: 50 * time.Millisecond, wantOK: true},
+		{name: "Retry-After seconds", retryAfter: "7", wantExact: 7 * time.Second, wantOK: true},
+		{name: "Retry-After in the past", retryAfter: time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), wantExact: 0, wantOK: true},
+		{name: "Retry-After over MaxRetryAfter", retryAfter: "120", wantExact: 2 * time.Minute, wantOK: false},
+		{name: "invalid Retry-After is ignored", retryAfter: "soon", attempt: 0, wantMax: 10 * time.Millisecond, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := &http.Response{Header: http.Header{}}
+			if tt.retryAfter != "" {
+				resp.Header.Set("Retry-After", tt.retryAfter)
+			}
+
+			seen := make(map[time.Duration]bool)
+			for i := 0; i < 100; i++ {
+				wait, ok := c.backoff(resp, tt.attempt)
+				if ok != tt.wantOK {
+					t.Fatalf("ok = %v, want %v", ok, tt.wantOK)
+				}
+				if tt.wantMax == 0 {
+					if wait != tt.wantExact {
+						t.Fatalf("wait = %v, want %v", wait, tt.wantExact)
+					}
+					continue
+				}
+				if wait < 0 || wait >= tt.wantMax {
+					t.Fatalf("wait = %v, want below %v", wait, tt.wantMax)
+				}
+				seen[wait] = true
+			}
+			if tt.wantMax != 0 && len(seen) < 10 {
+				t.Errorf("only %d different waits in 100, not jittered", len(seen))
+			}
+		})
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	tests := []struct {
+		value  string
+		want   time.Duration
+		wantOK bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"30", 30 * time.Second, true},
+		{"-1", 0, false},
+		{"1.5", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, ok := retryAfter(tt.value)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("retryAfter(%q) = %v, %v, want %v, %v", tt.value, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+
+	// A date in the future is how long until then
+	got, ok := retryAfter(time.Now().Add(time.Minute).UTC().Format(http.TimeFormat))
+	if !ok || got <= 58*time.Second || got > time.Minute {
+		t.Errorf("retryAfter(in a minute) = %v, %v", got, ok)
+	}
+}
@@ -1,2 +1,196 @@
 package middleware
 
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Gin context keys the authenticated user's ID and session ID are stored under.
+const (
+	ContextUserID    = "userID"
+	ContextSessionID = "sessionID"
+)
+
+const (
+	tokenUseAccess  = "access"
+	tokenUseRefresh = "refresh"
+	tokenUseStream  = "stream"
+)
+
+// Claims are the claims of every kind of token. The subject is the user ID;
+// TokenUse keeps a token from being accepted as another kind.
+type Claims struct {
+	TokenUse  string `json:"token_use"`
+	SessionID string `json:"sid"`
+	jwt.RegisteredClaims
+}
+
+// IssueAccessToken signs a short-lived access token for the user's session.
+func (a *AuthJWT) IssueAccessToken(userId string, sessionId string) (string, time.Time, error) {
+	return a.issue(userId, sessionId, "", tokenUseAccess, a.AccessTTL)
+}
+
+// IssueRefreshToken signs a refresh token for the user's session. tokenId is
+// stored as the jti, so the token can be looked up (and revoked) in the database.
+func (a *AuthJWT) IssueRefreshToken(userId string, sessionId string, tokenId string) (string, time.Time, error) {
+	return a.issue(userId, sessionId, tokenId, tokenUseRefresh, a.RefreshTTL)
+}
+
+// IssueStreamToken signs a token that opens the event streams and sockets of
+// the user's session. Browsers can't set headers on those, so it travels in
+// the URL and is good for nothing else.
+func (a *AuthJWT) IssueStreamToken(userId string, sessionId string) (string, time.Time, error) {
+	return a.issue(userId, sessionId, "", tokenUseStream, a.StreamTTL)
+}
+
+func (a *AuthJWT) issue(userId string, sessionId string, tokenId string, use string, ttl time.Duration) (string, time.Time, error) {
+	now := time.Now()
+	expiresAt := now.Add(ttl)
+	claims := Claims{
+		TokenUse:  use,
+		SessionID: sessionId,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        tokenId,
+			Subject:   userId,
+			IssuedAt:  jwt.NewNumericDate(now),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+	}
+
+	signed, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString(a.Secret)
+	if err != nil {
+		return "", time.Time{}, fmt.Errorf("error signing token: %v", err)
+	}
+	return signed, expiresAt, nil
+}
+
+// ParseAccessToken verifies an access token and returns its claims.
+func (a *AuthJWT) ParseAccessToken(token string) (*Claims, error) {
+	return a.parse(token, tokenUseAccess)
+}
+
+// ParseRefreshToken verifies the signature and expiry of a refresh token. The
+// caller still has to check the token against the database.
+func (a *AuthJWT) ParseRefreshToken(token string) (*Claims, error) {
+	return a.parse(token, tokenUseRefresh)
+}
+
+// ParseStreamToken verifies a stream token and returns its claims.
+func (a *AuthJWT) ParseStreamToken(token string) (*Claims, error) {
+	return a.parse(token, tokenUseStream)
+}
+
+func (a *AuthJWT) parse(token string, use string) (*Claims, error) {
+	var claims Claims
+	_, err := jwt.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		return a.Secret, nil
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}), jwt.WithExpirationRequired())
+	if err != nil {
+		return nil, err
+	}
+	if claims.TokenUse != use || claims.Subject == "" || claims.SessionID == "" {
+		return nil, errors.New("wrong token type")
+	}
+	return &claims, nil
+}
+
+// Handler rejects requests without a valid "Authorization: Bearer <access token>"
+// header, or whose session has been signed out, and stores the user and session
+// IDs from the token under ContextUserID and ContextSessionID.
+func (a *AuthJWT) Handler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		claims, ok := a.bearerClaims(c)
+		if !ok {
+			return
+		}
+		a.authorize(c, claims)
+	}
+}
+
+// StreamHandler is Handler for event streams and sockets, which browsers open
+// with EventSource and WebSocket and can't set headers on. Instead of the
+// header it takes a stream token (IssueStreamToken) in the token query
+// parameter; access and refresh tokens are refused there, so they never end
+// up in logs along with the URL.
+func (a *AuthJWT) StreamHandler() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			claims, ok := a.bearerClaims(c)
+			if !ok {
+				return
+			}
+			a.authorize(c, claims)
+			return
+		}
+
+		claims, err := a.ParseStreamToken(token)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired stream token"})
+			return
+		}
+		a.authorize(c, claims)
+	}
+}
+
+// bearerClaims returns the claims of the access token in the Authorization
+// header, or answers 401.
+func (a *AuthJWT) bearerClaims(c *gin.Context) (*Claims, bool) {
+	header := c.GetHeader("Authorization")
+	token, ok := strings.CutPrefix(header, "Bearer ")
+	if !ok || token == "" {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Missing bearer token"})
+		return nil, false
+	}
+
+	claims, err := a.ParseAccessToken(token)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Invalid or expired token"})
+		return nil, false
+	}
+	return claims, true
+}
+
+// authorize lets the request through if the token's session is still signed in.
+func (a *AuthJWT) authorize(c *gin.Context, claims *Claims) {
+	// Tokens are short-lived, but a revoked session has to stop working right away
+	active, err := a.sessionActive(claims.SessionID)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": "Unable to check session"})
+		return
+	}
+	if !active {
+		c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": "Session has been signed out"})
+		return
+	}
+
+	c.Set(ContextUserID, claims.Subject)
+	c.Set(ContextSessionID, claims.SessionID)
+	c.Next()
+}
+
+func (a *AuthJWT) sessionActive(sessionId string) (bool, error) {
+	var active bool
+	err := a.DB.QueryRow("SELECT revoked_at IS NULL FROM sessions WHERE id = $1", sessionId).Scan(&active)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, nil
+	}
+	return active, err
+}
+
+// UserID returns the ID of the user authenticated by Handler.
+func UserID(c *gin.Context) string {
+	return c.GetString(ContextUserID)
+}
+
+// SessionID returns the ID of the session the request's access token belongs to.
+func SessionID(c *gin.Context) string {
+	return c.GetString(ContextSessionID)
+}
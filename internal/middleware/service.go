@@ -1,7 +1,18 @@
 package middleware
 
-import "database/sql"
+import (
+	"database/sql"
+	"time"
+)
 
 type AuthJWT struct {
-	DB *sql.DB
+	DB         *sql.DB
+	Secret     []byte
+	AccessTTL  time.Duration
+	RefreshTTL time.Duration
+	StreamTTL  time.Duration
+}
+
+func NewAuthJWT(db *sql.DB, secret []byte, accessTTL time.Duration, refreshTTL time.Duration, streamTTL time.Duration) *AuthJWT {
+	return &AuthJWT{DB: db, Secret: secret, AccessTTL: accessTTL, RefreshTTL: refreshTTL, StreamTTL: streamTTL}
 }
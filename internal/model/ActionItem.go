@@ -0,0 +1,28 @@
+package model
+
+import "time"
+
+// Statuses of an action item.
+const (
+	ActionItemOpen = "open"
+	ActionItemDone = "done"
+)
+
+// ActionItem is a task from a meeting summary that the user tracks.
+type ActionItem struct {
+	ID          int    `json:"id"`
+	RecordingID int    `json:"recording_id"`
+	SummaryID   int    `json:"summary_id"`
+	UserID      string `json:"user_id"`
+	// Position is the item's index in the summary's action_items
+	Position int    `json:"position"`
+	Text     string `json:"text"`
+	Assignee string `json:"assignee,omitempty"`
+	// DueDate is YYYY-MM-DD, or empty without one
+	DueDate string `json:"due_date,omitempty"`
+	// SourceSeconds is where in the recording it came up
+	SourceSeconds *float64  `json:"source_seconds,omitempty"`
+	Status        string    `json:"status"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
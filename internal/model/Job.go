@@ -0,0 +1,33 @@
+package model
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Stages a job goes through, in order. A job ends in either JobStageDone or JobStageFailed.
+const (
+	JobStageUploading    = "uploading"
+	JobStageTranscribing = "transcribing"
+	JobStageSummarizing  = "summarizing"
+	// JobStageResearching looks up resources on the topics of the meeting, if configured
+	JobStageResearching = "researching"
+	JobStageDone        = "done"
+	JobStageFailed      = "failed"
+)
+
+type Job struct {
+	ID          string          `json:"id"`
+	RecordingID int             `json:"recording_id"`
+	UserID      string          `json:"user_id"`
+	Stage       string          `json:"stage"`
+	ChunksTotal int             `json:"chunks_total"`
+	ChunksDone  int             `json:"chunks_done"`
+	Result      json.RawMessage `json:"result,omitempty"`
+	Error       string          `json:"error,omitempty"`
+	// StorageKey and ETag identify the uploaded object once it is in storage
+	StorageKey string    `json:"storage_key,omitempty"`
+	ETag       string    `json:"etag,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// RefreshToken is one link of a session's rotation chain. A token is used
+// exactly once; UsedAt is set when it is swapped for the next one.
+type RefreshToken struct {
+	ID        string     `json:"id"`
+	SessionID string     `json:"session_id"`
+	UserID    string     `json:"user_id"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+	CreatedAt time.Time  `json:"created_at"`
+}
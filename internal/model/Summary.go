@@ -1,10 +1,35 @@
 package model
 
+import (
+	"encoding/json"
+	"time"
+)
+
 // keep the ID as uuid
 type Recording struct {
-	ID        uint `json:"id"`
-	UserID    uint `json:"user_id"`
-	IsDeleted bool `json:"is_deleted"`
-	CreatedAt uint `json:"created_at"`
-	UpdatedAt uint `json:"updated_at"`
+	ID         int       `json:"id"`
+	UserID     string    `json:"user_id"`
+	IsDeleted  bool      `json:"is_deleted"`
+	Uploaded   bool      `json:"uploaded"`
+	StorageKey string    `json:"storage_key"`
+	ETag       string    `json:"etag"`
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	// Language is what the recording was uploaded with, "auto" to detect it
+	Language         string `json:"language,omitempty"`
+	DetectedLanguage string `json:"detected_language,omitempty"`
+}
+
+type Summary struct {
+	ID           int             `json:"id"`
+	RecordingID  int             `json:"recording_id"`
+	TranscriptID int             `json:"transcript_id"`
+	UserID       string          `json:"user_id"`
+	Title        string          `json:"title"`
+	TLDR         string          `json:"tldr"`
+	Content      json.RawMessage `json:"content"`
+	// Version counts up from 1 every time the recording is processed again
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
 }
@@ -0,0 +1,24 @@
+package model
+
+import "time"
+
+type Transcript struct {
+	ID          int       `json:"id"`
+	RecordingID int       `json:"recording_id"`
+	Text        string    `json:"text"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+// TranscriptSegment is a timed piece of a transcript. Start and End are
+// seconds from the beginning of the recording.
+type TranscriptSegment struct {
+	ID           int      `json:"id"`
+	TranscriptID int      `json:"transcript_id"`
+	Position     int      `json:"position"`
+	Start        float64  `json:"start"`
+	End          float64  `json:"end"`
+	Text         string   `json:"text"`
+	Confidence   *float64 `json:"confidence,omitempty"`
+	// Speaker is the label the transcription gave the speaker, like "Speaker 1"
+	Speaker string `json:"speaker,omitempty"`
+}
@@ -0,0 +1,142 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+)
+
+type ActionItemRepository struct {
+	DB *sql.DB
+}
+
+func NewActionItemRepository(db *sql.DB) *ActionItemRepository {
+	return &ActionItemRepository{DB: db}
+}
+
+const actionItemColumns = `a.id, a.recording_id, a.summary_id, a.user_id, a.position, a.text, COALESCE(a.assignee, ''),
+	COALESCE(to_char(a.due_date, 'YYYY-MM-DD'), ''), a.source_seconds, a.status, a.created_at, a.updated_at`
+
+// CreateActionItems stores the action items of a summary, in order, as part of tx.
+func (ar *ActionItemRepository) CreateActionItems(tx *sql.Tx, items []model.ActionItem) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	stmt, err := tx.Prepare(`
+		INSERT INTO action_items (recording_id, summary_id, user_id, position, text, assignee, due_date, source_seconds, status)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, '')::date, $8, $9)
+	`)
+	if err != nil {
+		return err
+	}
+	defer stmt.Close()
+
+	for i, item := range items {
+		_, err := stmt.Exec(item.RecordingID, item.SummaryID, item.UserID, i, item.Text, item.Assignee, item.DueDate, item.SourceSeconds, item.Status)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListActionItemsByUser returns the user's action items with the given status
+// ("" for all), those due first. Only the items of the latest version of
+// every recording's summary are included.
+func (ar *ActionItemRepository) ListActionItemsByUser(userId string, status string) ([]model.ActionItem, error) {
+	rows, err := ar.DB.Query(`
+		SELECT `+actionItemColumns+`
+		FROM action_items a
+		JOIN summaries ON summaries.id = a.summary_id
+		WHERE a.user_id = $1 AND ($2 = '' OR a.status = $2) AND `+latestVersion+`
+		ORDER BY a.due_date NULLS LAST, a.created_at, a.position
+	`, userId, status)
+	if err != nil {
+		return nil, err
+	}
+	return scanActionItems(rows)
+}
+
+// ListActionItemsByRecording returns the action items of the latest version
+// of the recording's summary, in the order of the summary.
+func (ar *ActionItemRepository) ListActionItemsByRecording(recordingId int, userId string) ([]model.ActionItem, error) {
+	rows, err := ar.DB.Query(recordingActionItems, recordingId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanActionItems(rows)
+}
+
+// ListActionItemsByRecordingTx is ListActionItemsByRecording read as part of
+// tx, for writers that hold the recording's lock.
+func (ar *ActionItemRepository) ListActionItemsByRecordingTx(tx *sql.Tx, recordingId int, userId string) ([]model.ActionItem, error) {
+	rows, err := tx.Query(recordingActionItems, recordingId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanActionItems(rows)
+}
+
+const recordingActionItems = `
+	SELECT ` + actionItemColumns + `
+	FROM action_items a
+	JOIN summaries ON summaries.id = a.summary_id
+	WHERE a.recording_id = $1 AND a.user_id = $2 AND ` + latestVersion + `
+	ORDER BY a.position
+`
+
+// ListActionItemsBySummaryTx returns the action items of the user's summary,
+// in order, read as part of tx.
+func (ar *ActionItemRepository) ListActionItemsBySummaryTx(tx *sql.Tx, summaryId int, userId string) ([]model.ActionItem, error) {
+	rows, err := tx.Query(`
+		SELECT `+actionItemColumns+`
+		FROM action_items a
+		WHERE a.summary_id = $1 AND a.user_id = $2
+		ORDER BY a.position
+	`, summaryId, userId)
+	if err != nil {
+		return nil, err
+	}
+	return scanActionItems(rows)
+}
+
+// GetActionItem only finds action items owned by userId, anything else is sql.ErrNoRows.
+func (ar *ActionItemRepository) GetActionItem(id int, userId string) (model.ActionItem, error) {
+	row := ar.DB.QueryRow(`
+		SELECT `+actionItemColumns+`
+		FROM action_items a
+		WHERE a.id = $1 AND a.user_id = $2
+	`, id, userId)
+	return scanActionItem(row)
+}
+
+// UpdateActionItem saves the status and assignee of the item as part of tx.
+func (ar *ActionItemRepository) UpdateActionItem(tx *sql.Tx, item model.ActionItem) error {
+	_, err := tx.Exec(`
+		UPDATE action_items SET status = $2, assignee = NULLIF($3, ''), updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, item.ID, item.Status, item.Assignee)
+	return err
+}
+
+func scanActionItems(rows *sql.Rows) ([]model.ActionItem, error) {
+	defer rows.Close()
+
+	items := []model.ActionItem{}
+	for rows.Next() {
+		item, err := scanActionItem(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, rows.Err()
+}
+
+func scanActionItem(row scanner) (model.ActionItem, error) {
+	var a model.ActionItem
+	err := row.Scan(&a.ID, &a.RecordingID, &a.SummaryID, &a.UserID, &a.Position, &a.Text, &a.Assignee,
+		&a.DueDate, &a.SourceSeconds, &a.Status, &a.CreatedAt, &a.UpdatedAt)
+	return a, err
+}
@@ -0,0 +1,102 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+)
+
+type JobRepository struct {
+	DB *sql.DB
+}
+
+func NewJobRepository(db *sql.DB) *JobRepository {
+	return &JobRepository{DB: db}
+}
+
+func (jr *JobRepository) CreateJob(recordingId int, userId string) (string, error) {
+	var id string
+	err := jr.DB.QueryRow(
+		"INSERT INTO jobs (recording_id, user_id, stage) VALUES ($1, $2, $3) RETURNING id",
+		recordingId, userId, model.JobStageUploading,
+	).Scan(&id)
+	return id, err
+}
+
+// CreateUploadJob marks the recording as uploaded and creates its job in one
+// statement. It returns sql.ErrNoRows if the recording was already marked, so
+// an upload completed twice is only processed once.
+func (jr *JobRepository) CreateUploadJob(recordingId int, etag string) (string, error) {
+	var id string
+	err := jr.DB.QueryRow(`
+		WITH uploaded AS (
+			UPDATE recording SET uploaded = true, etag = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $1 AND uploaded = false
+			RETURNING id, user_id
+		)
+		INSERT INTO jobs (recording_id, user_id, stage)
+		SELECT id, user_id, $3 FROM uploaded
+		RETURNING id
+	`, recordingId, etag, model.JobStageUploading).Scan(&id)
+	return id, err
+}
+
+func (jr *JobRepository) UpdateJobStage(id string, stage string) error {
+	_, err := jr.DB.Exec("UPDATE jobs SET stage = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1", id, stage)
+	return err
+}
+
+func (jr *JobRepository) UpdateJobProgress(id string, done int, total int) error {
+	_, err := jr.DB.Exec(
+		"UPDATE jobs SET chunks_done = $2, chunks_total = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id, done, total,
+	)
+	return err
+}
+
+func (jr *JobRepository) CompleteJob(id string, result []byte) error {
+	_, err := jr.DB.Exec(
+		"UPDATE jobs SET stage = $2, result = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id, model.JobStageDone, result,
+	)
+	return err
+}
+
+func (jr *JobRepository) FailJob(id string, reason string) error {
+	_, err := jr.DB.Exec(
+		"UPDATE jobs SET stage = $2, error = $3, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id, model.JobStageFailed, reason,
+	)
+	return err
+}
+
+// HasRunningJob reports whether a job of the recording is neither done nor failed.
+func (jr *JobRepository) HasRunningJob(recordingId int) (bool, error) {
+	var running bool
+	err := jr.DB.QueryRow(
+		"SELECT EXISTS (SELECT 1 FROM jobs WHERE recording_id = $1 AND stage NOT IN ($2, $3))",
+		recordingId, model.JobStageDone, model.JobStageFailed,
+	).Scan(&running)
+	return running, err
+}
+
+// GetJobById returns sql.ErrNoRows if the job doesn't exist.
+func (jr *JobRepository) GetJobById(id string) (model.Job, error) {
+	var job model.Job
+	var result []byte
+	var reason sql.NullString
+	err := jr.DB.QueryRow(`
+		SELECT j.id, j.recording_id, j.user_id, j.stage, j.chunks_total, j.chunks_done, j.result, j.error,
+			COALESCE(r.storage_key, ''), COALESCE(r.etag, ''), j.created_at, j.updated_at
+		FROM jobs j
+		JOIN recording r ON r.id = j.recording_id
+		WHERE j.id = $1
+	`, id).Scan(&job.ID, &job.RecordingID, &job.UserID, &job.Stage, &job.ChunksTotal, &job.ChunksDone, &result, &reason,
+		&job.StorageKey, &job.ETag, &job.CreatedAt, &job.UpdatedAt)
+	if err != nil {
+		return model.Job{}, err
+	}
+	job.Result = result
+	job.Error = reason.String
+	return job, nil
+}
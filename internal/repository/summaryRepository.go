@@ -3,6 +3,8 @@ package repository
 import (
 	"database/sql"
 	"fmt"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
 )
 
 type RecordingRepository struct {
@@ -13,38 +15,237 @@ func NewRecordingRepository(db *sql.DB) *RecordingRepository {
 	return &RecordingRepository{DB: db}
 }
 
-func (sr *RecordingRepository) CreateRecording(userId string) int {
-	rows, err := sr.DB.Query("INSERT INTO recording (user_id) VALUES ($1) RETURNING id", userId)
-	fmt.Println("error db = ", err, userId)
+// CreateRecording inserts a recording for the user and gives it its storage
+// key in the same transaction, so the key always matches the row it belongs to.
+// language may be empty to use the default.
+func (sr *RecordingRepository) CreateRecording(userId string, language string) (model.Recording, error) {
+	tx, err := sr.DB.Begin()
 	if err != nil {
-		panic(err)
+		return model.Recording{}, err
 	}
+	defer tx.Rollback()
 
-	defer rows.Close()
+	var r model.Recording
+	err = tx.QueryRow(`
+		INSERT INTO recording (user_id, language) VALUES ($1, NULLIF($2, ''))
+		RETURNING id, user_id, is_deleted, uploaded, COALESCE(language, ''), created_at, updated_at
+	`, userId, language).Scan(&r.ID, &r.UserID, &r.IsDeleted, &r.Uploaded, &r.Language, &r.CreatedAt, &r.UpdatedAt)
+	if err != nil {
+		return model.Recording{}, err
+	}
+
+	r.StorageKey = recordingKey(r.ID, r.UserID)
+	if _, err := tx.Exec("UPDATE recording SET storage_key = $2 WHERE id = $1", r.ID, r.StorageKey); err != nil {
+		return model.Recording{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return model.Recording{}, err
+	}
+	return r, nil
+}
+
+// recordingKey is the object key of a recording in storage. Only
+// CreateRecording calls it, everybody else reads the storage_key column.
+func recordingKey(id int, userId string) string {
+	return fmt.Sprintf("%d-%s", id, userId)
+}
+
+// UpdateRecordingUploaded marks the recording as uploaded and records the
+// ETag of the stored object.
+func (sr *RecordingRepository) UpdateRecordingUploaded(id int, etag string) error {
+	_, err := sr.DB.Exec(
+		"UPDATE recording SET uploaded = true, etag = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id, etag,
+	)
+	return err
+}
+
+// LockRecording holds the recording's row until tx ends, so whoever writes a
+// new version of its summary waits for the one writing the version before.
+func (sr *RecordingRepository) LockRecording(tx *sql.Tx, id int) error {
+	_, err := tx.Exec("SELECT 1 FROM recording WHERE id = $1 FOR UPDATE", id)
+	return err
+}
+
+// UpdateRecordingDetectedLanguage records the language the transcription found.
+func (sr *RecordingRepository) UpdateRecordingDetectedLanguage(id int, language string) error {
+	_, err := sr.DB.Exec(
+		"UPDATE recording SET detected_language = $2, updated_at = CURRENT_TIMESTAMP WHERE id = $1",
+		id, language,
+	)
+	return err
+}
+
+// GetRecordingByStorageKey returns sql.ErrNoRows if no recording is stored under key.
+func (sr *RecordingRepository) GetRecordingByStorageKey(key string) (model.Recording, error) {
+	var r model.Recording
+	err := sr.DB.QueryRow(`
+		SELECT id, user_id, is_deleted, uploaded, COALESCE(storage_key, ''), COALESCE(etag, ''),
+			COALESCE(language, ''), COALESCE(detected_language, ''), created_at, updated_at
+		FROM recording
+		WHERE storage_key = $1 AND is_deleted = false
+	`, key).Scan(&r.ID, &r.UserID, &r.IsDeleted, &r.Uploaded, &r.StorageKey, &r.ETag,
+		&r.Language, &r.DetectedLanguage, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// GetRecording returns sql.ErrNoRows if the recording doesn't exist or was deleted.
+func (sr *RecordingRepository) GetRecording(id int) (model.Recording, error) {
+	var r model.Recording
+	err := sr.DB.QueryRow(`
+		SELECT id, user_id, is_deleted, uploaded, COALESCE(storage_key, ''), COALESCE(etag, ''),
+			COALESCE(language, ''), COALESCE(detected_language, ''), created_at, updated_at
+		FROM recording
+		WHERE id = $1 AND is_deleted = false
+	`, id).Scan(&r.ID, &r.UserID, &r.IsDeleted, &r.Uploaded, &r.StorageKey, &r.ETag,
+		&r.Language, &r.DetectedLanguage, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+type SummaryRepository struct {
+	DB *sql.DB
+}
+
+func NewSummaryRepository(db *sql.DB) *SummaryRepository {
+	return &SummaryRepository{DB: db}
+}
+
+// CreateSummary stores the summary as the next version for its recording, as
+// part of tx. The caller holds LockRecording, or two writers could pick the
+// same version.
+func (sr *SummaryRepository) CreateSummary(tx *sql.Tx, summary model.Summary) (int, error) {
 	var id int
-	if rows.Next() {
-		err = rows.Scan(&id)
-		if err != nil {
-			panic(err)
-		}
+	err := tx.QueryRow(`
+		INSERT INTO summaries (recording_id, transcript_id, user_id, title, tldr, content, version)
+		SELECT $1, $2, $3, $4, $5, $6, COALESCE(MAX(version), 0) + 1
+		FROM summaries
+		WHERE recording_id = $1
+		RETURNING id
+	`, summary.RecordingID, summary.TranscriptID, summary.UserID, summary.Title, summary.TLDR, []byte(summary.Content)).Scan(&id)
+	return id, err
+}
+
+// UpdateSummaryContent replaces the summary in place, without a new version,
+// as part of tx.
+func (sr *SummaryRepository) UpdateSummaryContent(tx *sql.Tx, summary model.Summary) error {
+	_, err := tx.Exec(`
+		UPDATE summaries SET title = $2, tldr = $3, content = $4, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, summary.ID, summary.Title, summary.TLDR, []byte(summary.Content))
+	return err
+}
+
+// UpdateActionItemOwner sets the owner of the action item at position in the
+// summary's content as part of tx, or removes it for "". The rest of the
+// content is left as it is.
+func (sr *SummaryRepository) UpdateActionItemOwner(tx *sql.Tx, summaryId int, position int, owner string) error {
+	_, err := tx.Exec(`
+		UPDATE summaries SET content = CASE
+				WHEN $3::text = '' THEN content #- ARRAY['action_items', ($2::int)::text, 'owner']
+				ELSE jsonb_set(content, ARRAY['action_items', ($2::int)::text, 'owner'], to_jsonb($3::text))
+			END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND jsonb_typeof(content->'action_items'->($2::int)) = 'object'
+	`, summaryId, position, owner)
+	return err
+}
+
+// latestVersion keeps only the newest version of every recording's summary.
+const latestVersion = `NOT EXISTS (
+	SELECT 1 FROM summaries newer
+	WHERE newer.recording_id = summaries.recording_id AND newer.version > summaries.version
+)`
+
+// ListSummariesByUser returns one page of the user's summaries, newest first,
+// along with the total number of summaries the user has. Only the latest
+// version of every recording's summary is included.
+func (sr *SummaryRepository) ListSummariesByUser(userId string, limit int, offset int) ([]model.Summary, int, error) {
+	var total int
+	if err := sr.DB.QueryRow("SELECT COUNT(*) FROM summaries WHERE user_id = $1 AND "+latestVersion, userId).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := sr.DB.Query(`
+		SELECT id, recording_id, transcript_id, user_id, title, tldr, content, version, created_at, updated_at
+		FROM summaries
+		WHERE user_id = $1 AND `+latestVersion+`
+		ORDER BY created_at DESC, id DESC
+		LIMIT $2 OFFSET $3
+	`, userId, limit, offset)
+	if err != nil {
+		return nil, 0, err
 	}
-	return id
+	return scanSummaries(rows, total)
 }
 
-func (sr *RecordingRepository) UpdateRecordingUploaded(id int) {
-	_, err := sr.DB.Query("UPDATE recording SET uploaded = true WHERE id = $1", id)
+// ListSummaryVersions returns every version of the recording's summary, newest first.
+func (sr *SummaryRepository) ListSummaryVersions(recordingId int, userId string) ([]model.Summary, error) {
+	rows, err := sr.DB.Query(`
+		SELECT id, recording_id, transcript_id, user_id, title, tldr, content, version, created_at, updated_at
+		FROM summaries
+		WHERE recording_id = $1 AND user_id = $2
+		ORDER BY version DESC
+	`, recordingId, userId)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
+	summaries, _, err := scanSummaries(rows, 0)
+	return summaries, err
 }
 
-func (sr *RecordingRepository) GetRecordingById(id int) bool {
-	rows, err := sr.DB.Query("SELECT 1 FROM recording WHERE id = $1 AND uploaded = true", id)
+// ListSummariesByTranscriptTx returns every version of the user's summary
+// written from the transcript, read as part of tx.
+func (sr *SummaryRepository) ListSummariesByTranscriptTx(tx *sql.Tx, transcriptId int, userId string) ([]model.Summary, error) {
+	rows, err := tx.Query(`
+		SELECT id, recording_id, transcript_id, user_id, title, tldr, content, version, created_at, updated_at
+		FROM summaries
+		WHERE transcript_id = $1 AND user_id = $2
+		ORDER BY version
+	`, transcriptId, userId)
 	if err != nil {
-		return false
+		return nil, err
 	}
+	summaries, _, err := scanSummaries(rows, 0)
+	return summaries, err
+}
 
+func scanSummaries(rows *sql.Rows, total int) ([]model.Summary, int, error) {
 	defer rows.Close()
 
-	return rows.Next()
+	summaries := []model.Summary{}
+	for rows.Next() {
+		s, err := scanSummary(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		summaries = append(summaries, s)
+	}
+
+	return summaries, total, rows.Err()
+}
+
+// GetSummaryById only finds summaries owned by userId, anything else is sql.ErrNoRows.
+func (sr *SummaryRepository) GetSummaryById(id int, userId string) (model.Summary, error) {
+	row := sr.DB.QueryRow(`
+		SELECT id, recording_id, transcript_id, user_id, title, tldr, content, version, created_at, updated_at
+		FROM summaries
+		WHERE id = $1 AND user_id = $2
+	`, id, userId)
+	return scanSummary(row)
+}
+
+// scanner is implemented by both *sql.Row and *sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanSummary(row scanner) (model.Summary, error) {
+	var s model.Summary
+	var content []byte
+	if err := row.Scan(&s.ID, &s.RecordingID, &s.TranscriptID, &s.UserID, &s.Title, &s.TLDR, &content, &s.Version, &s.CreatedAt, &s.UpdatedAt); err != nil {
+		return model.Summary{}, err
+	}
+	s.Content = content
+	return s, nil
 }
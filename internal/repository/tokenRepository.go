@@ -0,0 +1,119 @@
+package repository
+
+import (
+	"database/sql"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+)
+
+type RefreshTokenRepository struct {
+	DB *sql.DB
+}
+
+func NewRefreshTokenRepository(db *sql.DB) *RefreshTokenRepository {
+	return &RefreshTokenRepository{DB: db}
+}
+
+func (rr *RefreshTokenRepository) CreateSession(userId string, userAgent string, ipAddress string) (string, error) {
+	var id string
+	err := rr.DB.QueryRow(
+		"INSERT INTO sessions (user_id, user_agent, ip_address) VALUES ($1, $2, $3) RETURNING id",
+		userId, userAgent, ipAddress,
+	).Scan(&id)
+	return id, err
+}
+
+// GetSession returns sql.ErrNoRows if the session doesn't exist.
+func (rr *RefreshTokenRepository) GetSession(id string) (model.Session, error) {
+	row := rr.DB.QueryRow(`
+		SELECT id, user_id, COALESCE(user_agent, ''), COALESCE(ip_address, ''), revoked_at, created_at, last_used_at
+		FROM sessions
+		WHERE id = $1
+	`, id)
+	return scanSession(row)
+}
+
+// ListActiveSessions returns the user's sessions that are neither revoked nor
+// expired, most recently used first.
+func (rr *RefreshTokenRepository) ListActiveSessions(userId string) ([]model.Session, error) {
+	rows, err := rr.DB.Query(`
+		SELECT s.id, s.user_id, COALESCE(s.user_agent, ''), COALESCE(s.ip_address, ''), s.revoked_at, s.created_at, s.last_used_at
+		FROM sessions s
+		WHERE s.user_id = $1
+		  AND s.revoked_at IS NULL
+		  AND EXISTS (
+		      SELECT 1 FROM refresh_tokens t
+		      WHERE t.session_id = s.id AND t.used_at IS NULL AND t.expires_at > CURRENT_TIMESTAMP
+		  )
+		ORDER BY s.last_used_at DESC
+	`, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	sessions := []model.Session{}
+	for rows.Next() {
+		s, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, s)
+	}
+	return sessions, rows.Err()
+}
+
+func (rr *RefreshTokenRepository) TouchSession(id string) error {
+	_, err := rr.DB.Exec("UPDATE sessions SET last_used_at = CURRENT_TIMESTAMP WHERE id = $1", id)
+	return err
+}
+
+// RevokeSession signs the session out. It reports false if the user has no
+// such session or it was already revoked.
+func (rr *RefreshTokenRepository) RevokeSession(id string, userId string) (bool, error) {
+	res, err := rr.DB.Exec(
+		"UPDATE sessions SET revoked_at = CURRENT_TIMESTAMP WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL",
+		id, userId,
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func (rr *RefreshTokenRepository) CreateRefreshToken(sessionId string, userId string, expiresAt time.Time) (string, error) {
+	var id string
+	err := rr.DB.QueryRow(
+		"INSERT INTO refresh_tokens (session_id, user_id, expires_at) VALUES ($1, $2, $3) RETURNING id",
+		sessionId, userId, expiresAt,
+	).Scan(&id)
+	return id, err
+}
+
+// GetRefreshToken returns sql.ErrNoRows if the token doesn't exist.
+func (rr *RefreshTokenRepository) GetRefreshToken(id string) (model.RefreshToken, error) {
+	var t model.RefreshToken
+	err := rr.DB.QueryRow(
+		"SELECT id, session_id, user_id, expires_at, used_at, created_at FROM refresh_tokens WHERE id = $1", id,
+	).Scan(&t.ID, &t.SessionID, &t.UserID, &t.ExpiresAt, &t.UsedAt, &t.CreatedAt)
+	return t, err
+}
+
+// MarkRefreshTokenUsed atomically consumes the token. It reports false if the
+// token had already been used, which means it is being replayed.
+func (rr *RefreshTokenRepository) MarkRefreshTokenUsed(id string) (bool, error) {
+	res, err := rr.DB.Exec("UPDATE refresh_tokens SET used_at = CURRENT_TIMESTAMP WHERE id = $1 AND used_at IS NULL", id)
+	if err != nil {
+		return false, err
+	}
+	n, err := res.RowsAffected()
+	return n > 0, err
+}
+
+func scanSession(row scanner) (model.Session, error) {
+	var s model.Session
+	err := row.Scan(&s.ID, &s.UserID, &s.UserAgent, &s.IPAddress, &s.RevokedAt, &s.CreatedAt, &s.LastUsedAt)
+	return s, err
+}
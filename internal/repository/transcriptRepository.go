@@ -0,0 +1,107 @@
+package repository
+
+import (
+	"database/sql"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+)
+
+type TranscriptRepository struct {
+	DB *sql.DB
+}
+
+func NewTranscriptRepository(db *sql.DB) *TranscriptRepository {
+	return &TranscriptRepository{DB: db}
+}
+
+// CreateTranscript stores the transcript together with its segments, in order,
+// as part of tx.
+func (tr *TranscriptRepository) CreateTranscript(tx *sql.Tx, recordingId int, text string, segments []model.TranscriptSegment) (int, error) {
+	var id int
+	err := tx.QueryRow(
+		"INSERT INTO transcripts (recording_id, text) VALUES ($1, $2) RETURNING id",
+		recordingId, text,
+	).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(segments) > 0 {
+		stmt, err := tx.Prepare(`
+			INSERT INTO transcript_segments (transcript_id, position, start_seconds, end_seconds, text, confidence, speaker)
+			VALUES ($1, $2, $3, $4, $5, $6, NULLIF($7, ''))
+		`)
+		if err != nil {
+			return 0, err
+		}
+		defer stmt.Close()
+
+		for i, s := range segments {
+			if _, err := stmt.Exec(id, i, s.Start, s.End, s.Text, s.Confidence, s.Speaker); err != nil {
+				return 0, err
+			}
+		}
+	}
+	return id, nil
+}
+
+// GetTranscriptById returns sql.ErrNoRows if the transcript doesn't exist.
+func (tr *TranscriptRepository) GetTranscriptById(id int) (model.Transcript, error) {
+	var t model.Transcript
+	err := tr.DB.QueryRow(
+		"SELECT id, recording_id, text, created_at FROM transcripts WHERE id = $1", id,
+	).Scan(&t.ID, &t.RecordingID, &t.Text, &t.CreatedAt)
+	return t, err
+}
+
+// GetSegmentsByTranscriptId returns the segments of the transcript in order.
+func (tr *TranscriptRepository) GetSegmentsByTranscriptId(transcriptId int) ([]model.TranscriptSegment, error) {
+	rows, err := tr.DB.Query(`
+		SELECT id, transcript_id, position, start_seconds, end_seconds, text, confidence, COALESCE(speaker, '')
+		FROM transcript_segments
+		WHERE transcript_id = $1
+		ORDER BY position
+	`, transcriptId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var segments []model.TranscriptSegment
+	for rows.Next() {
+		var s model.TranscriptSegment
+		if err := rows.Scan(&s.ID, &s.TranscriptID, &s.Position, &s.Start, &s.End, &s.Text, &s.Confidence, &s.Speaker); err != nil {
+			return nil, err
+		}
+		segments = append(segments, s)
+	}
+	return segments, rows.Err()
+}
+
+// GetSpeakerNames returns the names given to the transcript's speaker labels.
+func (tr *TranscriptRepository) GetSpeakerNames(transcriptId int) (map[string]string, error) {
+	rows, err := tr.DB.Query("SELECT label, name FROM transcript_speakers WHERE transcript_id = $1", transcriptId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := make(map[string]string)
+	for rows.Next() {
+		var label, name string
+		if err := rows.Scan(&label, &name); err != nil {
+			return nil, err
+		}
+		names[label] = name
+	}
+	return names, rows.Err()
+}
+
+// SetSpeakerName names the transcript's speaker label as part of tx.
+func (tr *TranscriptRepository) SetSpeakerName(tx *sql.Tx, transcriptId int, label string, name string) error {
+	_, err := tx.Exec(`
+		INSERT INTO transcript_speakers (transcript_id, label, name) VALUES ($1, $2, $3)
+		ON CONFLICT (transcript_id, label) DO UPDATE SET name = EXCLUDED.name, updated_at = CURRENT_TIMESTAMP
+	`, transcriptId, label, name)
+	return err
+}
@@ -20,7 +20,7 @@ func (rs *UserRepository) NewUserRepository(db *sql.DB) *UserRepository {
 
 func (ur *UserRepository) GetAllUsers() ([]model.User, error) {
 	rows, err := ur.db.Query(`
-		SELECT id, first_name, last_name, email, password, created_at, updated_at 
+		SELECT user_id, first_name, last_name, email, password, created_at, updated_at
 		FROM users
 	`)
 	if err != nil {
@@ -41,7 +41,7 @@ func (ur *UserRepository) GetAllUsers() ([]model.User, error) {
 }
 
 func (ur *UserRepository) GetUserByEmail(email string) (model.User, error) {
-	rows, err := ur.db.Query("SELECT * FROM users WHERE email=$1", email)
+	rows, err := ur.db.Query("SELECT user_id, first_name, last_name, email, password, created_at, updated_at FROM users WHERE email=$1", email)
 	if err != nil {
 		return model.User{}, err
 	}
@@ -69,3 +69,20 @@ func (ur *UserRepository) CreateUser(user model.User) error {
 	`, user.FirstName, user.LastName, user.Email, user.Password)
 	return err
 }
+
+// GetUserLanguage returns the user's default recording language, or "" if
+// they haven't picked one.
+func (ur *UserRepository) GetUserLanguage(userId string) (string, error) {
+	var language string
+	err := ur.db.QueryRow("SELECT COALESCE(language, '') FROM users WHERE user_id = $1", userId).Scan(&language)
+	return language, err
+}
+
+// SetUserLanguage sets the user's default recording language, "" clears it.
+func (ur *UserRepository) SetUserLanguage(userId string, language string) error {
+	_, err := ur.db.Exec(
+		"UPDATE users SET language = NULLIF($2, ''), updated_at = CURRENT_TIMESTAMP WHERE user_id = $1",
+		userId, language,
+	)
+	return err
+}
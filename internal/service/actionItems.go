@@ -0,0 +1,137 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+// ErrInvalidStatus is returned for an action item status other than open or done.
+var ErrInvalidStatus = errors.New("status must be open or done")
+
+// saveActionItems stores the action items of a new summary as part of tx.
+// Items the previous version of the summary had too keep their status, so
+// reprocessing a recording doesn't undo what the user tracked; their
+// assignees are already in the summary (carryOverAssignees).
+func (us *UserService) saveActionItems(tx *sql.Tx, recordingId int, summaryId int, userId string, summary *types.MeetingSummary, previous []model.ActionItem) error {
+	tracked := trackedActionItems(previous)
+
+	items := make([]model.ActionItem, 0, len(summary.ActionItems))
+	for _, a := range summary.ActionItems {
+		item := model.ActionItem{
+			RecordingID: recordingId,
+			SummaryID:   summaryId,
+			UserID:      userId,
+			Text:        a.Description,
+			Assignee:    a.Owner,
+			DueDate:     a.DueDate,
+			Status:      model.ActionItemOpen,
+		}
+		if d, ok := parseTimestamp(a.Timestamp); ok {
+			seconds := d.Seconds()
+			item.SourceSeconds = &seconds
+		}
+		if before, ok := tracked[actionItemKey(a.Description)]; ok {
+			item.Status = before.Status
+		}
+		items = append(items, item)
+	}
+
+	return us.actionItemRepo.CreateActionItems(tx, items)
+}
+
+// carryOverAssignees hands the action items of a new summary to whoever the
+// user assigned them to on the previous version, before the summary is
+// stored, so its content and the action_items table agree.
+func carryOverAssignees(summary *types.MeetingSummary, previous []model.ActionItem) {
+	tracked := trackedActionItems(previous)
+	for i, a := range summary.ActionItems {
+		if before, ok := tracked[actionItemKey(a.Description)]; ok {
+			summary.ActionItems[i].Owner = before.Assignee
+		}
+	}
+}
+
+// trackedActionItems indexes the items of a previous version by their text.
+func trackedActionItems(previous []model.ActionItem) map[string]model.ActionItem {
+	tracked := make(map[string]model.ActionItem, len(previous))
+	for _, item := range previous {
+		tracked[actionItemKey(item.Text)] = item
+	}
+	return tracked
+}
+
+func actionItemKey(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+// ListActionItems returns the user's action items with the given status, or
+// all of them for "", those due first.
+func (us *UserService) ListActionItems(userId string, status string) ([]model.ActionItem, error) {
+	if status != "" && status != model.ActionItemOpen && status != model.ActionItemDone {
+		return nil, ErrInvalidStatus
+	}
+	if !isUUID(userId) {
+		return []model.ActionItem{}, nil
+	}
+	return us.actionItemRepo.ListActionItemsByUser(userId, status)
+}
+
+// ListRecordingActionItems returns the action items of the latest summary of
+// the user's recording, or ErrRecordingNotFound.
+func (us *UserService) ListRecordingActionItems(recordingId int, userId string) ([]model.ActionItem, error) {
+	recording, err := us.recordingRepo.GetRecording(recordingId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && recording.UserID != userId) {
+		return nil, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return us.actionItemRepo.ListActionItemsByRecording(recordingId, userId)
+}
+
+// UpdateActionItem marks the user's action item done or open again, or hands
+// it to someone else, in the summary as well. Returns sql.ErrNoRows if the user has no such item.
+func (us *UserService) UpdateActionItem(id int, userId string, req types.UpdateActionItemRequest) (model.ActionItem, error) {
+	if !isUUID(userId) {
+		return model.ActionItem{}, sql.ErrNoRows
+	}
+	item, err := us.actionItemRepo.GetActionItem(id, userId)
+	if err != nil {
+		return model.ActionItem{}, err
+	}
+
+	if req.Status != nil {
+		if *req.Status != model.ActionItemOpen && *req.Status != model.ActionItemDone {
+			return model.ActionItem{}, ErrInvalidStatus
+		}
+		item.Status = *req.Status
+	}
+	if req.Assignee != nil {
+		item.Assignee = strings.TrimSpace(*req.Assignee)
+	}
+
+	tx, err := us.DB.Begin()
+	if err != nil {
+		return model.ActionItem{}, err
+	}
+	defer tx.Rollback()
+
+	if err := us.actionItemRepo.UpdateActionItem(tx, item); err != nil {
+		return model.ActionItem{}, err
+	}
+	// The summary names the owner too, both have to agree
+	if req.Assignee != nil {
+		if err := us.summaryRepo.UpdateActionItemOwner(tx, item.SummaryID, item.Position, item.Assignee); err != nil {
+			return model.ActionItem{}, fmt.Errorf("error updating summary: %v", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return model.ActionItem{}, err
+	}
+	return us.actionItemRepo.GetActionItem(id, userId)
+}
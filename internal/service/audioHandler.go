@@ -1,36 +1,40 @@
 package service
 
 import (
+	"bytes"
 	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"mime/multipart"
 	"net/http"
-	"os"
+	"path/filepath"
+	"strings"
 	"sync"
+	"time"
 
-	"github.com/aws/aws-sdk-go-v2/config"
-	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
-	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+	"github.com/cyberhawk12121/Saarthi/internal/middleware"
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
 	"github.com/gin-gonic/gin"
 )
 
-// LemonFoxResponse models the JSON response from LemonFox
-type LemonFoxResponse struct {
-	Text string `json:"text"`
-}
-
-// UploadAudio handles the "receive file → simultaneously upload to S3 and
-// chunk-transcribe with LemonFox → pass the combined transcription to Llama → return result."
+// UploadAudio accepts the recording and starts a background job that does the
+// "simultaneously upload to S3 and chunk-transcribe with LemonFox → pass the
+// combined transcription to the Summarizer" work. It answers with the job ID straight away;
+// progress and the result are read from GET /jobs/:id, or followed live on
+// GET /recordings/:id/events.
 func (us *UserService) UploadAudio(c *gin.Context) {
 	//-------------------------------------------------------------------
 	// 1. Receive file from client
 	//-------------------------------------------------------------------
 	fileHeader, err := c.FormFile("file")
-	// Read the userId from the body
-	userId := c.PostForm("user_id")
+	// The user comes from the access token, never from the form
+	userId := middleware.UserID(c)
 	// request header should be "Content-Type: multipart/form-data"
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "File not found in the request"})
@@ -43,6 +47,22 @@ func (us *UserService) UploadAudio(c *gin.Context) {
 		return
 	}
 
+	// An optional language for this recording, "auto" to detect it
+	language, err := us.recordingLanguage(userId, c.PostForm("language"))
+	if errors.Is(err, ErrUnsupportedLanguage) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read language preference"})
+		return
+	}
+	run, err := us.withOverrides(types.ReprocessRequest{Language: language})
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Open the uploaded file
 	file, err := fileHeader.Open()
 	if err != nil {
@@ -51,6 +71,55 @@ func (us *UserService) UploadAudio(c *gin.Context) {
 	}
 	defer file.Close()
 
+	// The multipart temp files are removed when the request ends, so keep our own copy
+	data, err := io.ReadAll(file)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to read uploaded file"})
+		return
+	}
+
+	//-------------------------------------------------------------------
+	// 2. Create the recording and the job that tracks it
+	//-------------------------------------------------------------------
+	recording, err := us.recordingRepo.CreateRecording(userId, language)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create recording"})
+		return
+	}
+	jobId, err := us.jobRepo.CreateJob(recording.ID, userId)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Unable to create job"})
+		return
+	}
+
+	//-------------------------------------------------------------------
+	// 3. Process in the background and hand back the job ID
+	//-------------------------------------------------------------------
+	go run.processUpload(jobId, recording, fileHeader.Filename, data)
+
+	c.JSON(http.StatusAccepted, gin.H{"job_id": jobId, "recording_id": recording.ID})
+}
+
+// GetJob returns the user's job with the given ID, or sql.ErrNoRows.
+func (us *UserService) GetJob(id string, userId string) (model.Job, error) {
+	if !isUUID(id) {
+		return model.Job{}, sql.ErrNoRows
+	}
+	job, err := us.jobRepo.GetJobById(id)
+	if err != nil {
+		return model.Job{}, err
+	}
+	if job.UserID != userId {
+		return model.Job{}, sql.ErrNoRows
+	}
+	return job, nil
+}
+
+// processUpload runs the upload pipeline for a job and records every stage change.
+func (us *UserService) processUpload(jobId string, recording model.Recording, filename string, data []byte) {
+	ctx := context.Background()
+	us.events.Publish(recording.ID, EventStage, types.StageEvent{JobID: jobId, Stage: model.JobStageUploading})
+
 	//-------------------------------------------------------------------
 	// Create a TeeReader (fork the stream)
 	//-------------------------------------------------------------------
@@ -59,219 +128,322 @@ func (us *UserService) UploadAudio(c *gin.Context) {
 	//  - Chunk-transcribe the file (reading from pr)
 	//-------------------------------------------------------------------
 	pr, pw := io.Pipe()
-	teeReader := io.TeeReader(file, pw)
+	teeReader := io.TeeReader(bytes.NewReader(data), pw)
 
 	var wg sync.WaitGroup
 	wg.Add(2)
 
-	// Goroutine #1: Upload to S3
+	// Goroutine #1: Stream the file to storage (a multipart upload on S3)
+	var uploadErr error
 	go func() {
 		defer wg.Done()
-		defer pw.Close() // ensure the pipe is closed when S3 upload finishes
 
-		// initiate uploading to S3
-		id := us.recordingRepo.CreateRecording(userId)
-		if _, err := us.uploadToS3(teeReader, userId); err != nil {
-			fmt.Printf("Error uploading to S3: %v\n", err)
+		info, err := us.store.Put(ctx, recording.StorageKey, teeReader)
+		if err != nil {
+			uploadErr = err
+			// The transcriber will never see the rest of the file, unblock it
+			pw.CloseWithError(fmt.Errorf("upload to storage failed: %v", err))
+			return
 		}
+		pw.Close()
 
 		// Update the recording as uploaded
-		us.recordingRepo.UpdateRecordingUploaded(id)
+		if err := us.recordingRepo.UpdateRecordingUploaded(recording.ID, info.ETag); err != nil {
+			log.Printf("job %s: error marking recording %d as uploaded: %v", jobId, recording.ID, err)
+		}
 	}()
 
-	// Goroutine #2: Chunk-based transcription with LemonFox - Transcription would take longer than uploading to S3
-	var transcriptionResult string
+	// Goroutine #2: Chunk-based transcription - Transcription would take longer than uploading to S3
+	var transcriptionResult Transcript
 	var transcriptionErr error
 	go func() {
 		defer wg.Done()
 		defer pr.Close()
 
-		transcriptionResult, transcriptionErr = chunkedTranscription(pr)
+		transcriptionResult, transcriptionErr = us.chunkedTranscription(ctx, pr, filename, us.jobProgress(jobId, recording.ID), us.chunkTranscribed(jobId, recording.ID))
 	}()
 
 	//-------------------------------------------------------------------
-	// 2. Wait for concurrency (S3 + chunked transcription) to finish
+	// Wait for concurrency (S3 + chunked transcription) to finish
 	//-------------------------------------------------------------------
 	wg.Wait()
 
+	if uploadErr != nil {
+		us.failJob(jobId, recording.ID, fmt.Errorf("upload to storage failed: %v", uploadErr))
+		return
+	}
 	// @TODO: In case there is an error and we want to retry then we would need to download from S3 and do it
 	if transcriptionErr != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{
-			"error": fmt.Sprintf("Transcription failed: %v", transcriptionErr),
-		})
+		us.failJob(jobId, recording.ID, fmt.Errorf("transcription failed: %v", transcriptionErr))
 		return
 	}
 
+	us.finishJob(ctx, jobId, recording.ID, recording.UserID, transcriptionResult)
+}
+
+// finishJob summarizes the transcript, stores both and completes the job with
+// the summary as its result.
+func (us *UserService) finishJob(ctx context.Context, jobId string, recordingId int, userId string, transcript Transcript) {
 	//-------------------------------------------------------------------
-	// 3. Pass the combined transcription to the Llama API
+	// Pass the combined transcription to the Summarizer
 	//-------------------------------------------------------------------
-	llamaRespBody, statusCode, err := us.callLlamaAPI(transcriptionResult)
+	if transcript.Language != "" {
+		if err := us.recordingRepo.UpdateRecordingDetectedLanguage(recordingId, transcript.Language); err != nil {
+			log.Printf("job %s: error storing the language of recording %d: %v", jobId, recordingId, err)
+		}
+	}
+
+	us.setJobStage(jobId, recordingId, model.JobStageSummarizing)
+	summary, err := us.summarize(ctx, transcript, us.summaryDeltas(jobId, recordingId))
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		us.failJob(jobId, recordingId, err)
 		return
 	}
+	if us.resources != nil {
+		us.setJobStage(jobId, recordingId, model.JobStageResearching)
+		summary.Resources = us.findResources(ctx, summary)
+	}
 
 	//-------------------------------------------------------------------
-	// 4. Return the Llama API response to the client
+	// Store the transcript and summary, and keep the summary as the job result
 	//-------------------------------------------------------------------
-	c.Data(statusCode, "application/json", llamaRespBody)
+	summaryId, err := us.saveSummary(recordingId, userId, transcript, summary)
+	if err != nil {
+		us.failJob(jobId, recordingId, err)
+		return
+	}
+
+	result, err := json.Marshal(summary)
+	if err != nil {
+		us.failJob(jobId, recordingId, err)
+		return
+	}
+	if err := us.jobRepo.CompleteJob(jobId, result); err != nil {
+		log.Printf("job %s: error storing result: %v", jobId, err)
+	}
+
+	us.events.Publish(recordingId, EventSummary, types.SummaryEvent{JobID: jobId, SummaryID: summaryId, Summary: *summary})
+	us.events.Publish(recordingId, EventStage, types.StageEvent{JobID: jobId, Stage: model.JobStageDone})
+	us.events.Finish(recordingId)
 }
 
+// jobProgress records chunk progress on the job, moving it to the
+// transcribing stage once the chunks are known.
+func (us *UserService) jobProgress(jobId string, recordingId int) func(done, total int) {
+	return func(done, total int) {
+		if done == 0 {
+			us.setJobStage(jobId, recordingId, model.JobStageTranscribing)
+		}
+		if err := us.jobRepo.UpdateJobProgress(jobId, done, total); err != nil {
+			log.Printf("job %s: error updating progress: %v", jobId, err)
+		}
+		us.events.Publish(recordingId, EventProgress, types.ProgressEvent{JobID: jobId, ChunksDone: done, ChunksTotal: total})
+	}
+}
+
+func (us *UserService) setJobStage(jobId string, recordingId int, stage string) {
+	if err := us.jobRepo.UpdateJobStage(jobId, stage); err != nil {
+		log.Printf("job %s: error setting stage %s: %v", jobId, stage, err)
+	}
+	us.events.Publish(recordingId, EventStage, types.StageEvent{JobID: jobId, Stage: stage})
+}
+
+func (us *UserService) failJob(jobId string, recordingId int, reason error) {
+	log.Printf("job %s failed: %v", jobId, reason)
+	if err := us.jobRepo.FailJob(jobId, reason.Error()); err != nil {
+		log.Printf("job %s: error marking as failed: %v", jobId, err)
+	}
+	us.events.Publish(recordingId, EventStage, types.StageEvent{JobID: jobId, Stage: model.JobStageFailed, Error: reason.Error()})
+	us.events.Finish(recordingId)
+}
+
+// maxUploadSize is the largest recording we accept, however it is uploaded.
+const maxUploadSize = 1024 * 1024 * 100 // 100MB
+
 // sanitationChecks checks the size of the uploaded file, etc.
 func sanitationChecks(fileHeader *multipart.FileHeader) bool {
-	// Example: limit file size to 100MB
-	return fileHeader.Size <= 1024*1024*100
+	return fileHeader.Size <= maxUploadSize
 }
 
-func (us *UserService) uploadToS3(r io.Reader, userId string) (string, error) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(us.config.Region),
-	)
+// chunkedTranscription splits the recording on frame boundaries near silence,
+// transcribes the chunks in parallel and stitches the results back in order.
+// Segment times are moved by the chunk's offset, so they point into the whole
+// recording. progress, if not nil, is called once the chunks are known and
+// after every finished chunk, and onChunk, if not nil, with the transcript of
+// every chunk as soon as it is in.
+func (us *UserService) chunkedTranscription(ctx context.Context, r io.Reader, filename string, progress func(done, total int), onChunk func(audio.Chunk, Transcript)) (Transcript, error) {
+	data, err := io.ReadAll(r)
 	if err != nil {
-		log.Println("error:", err)
-		return "", err
+		return Transcript{}, fmt.Errorf("error reading audio: %v", err)
 	}
 
-	rows, err := us.DB.Query("SELECT id FROM recording ORDER BY created_at DESC LIMIT 1")
+	chunks, err := audio.Split(data, audio.DefaultOptions())
 	if err != nil {
-		return "", err
+		return Transcript{}, fmt.Errorf("error splitting audio: %v", err)
 	}
 
-	defer rows.Close()
-	var id int
-	if rows.Next() {
-		err = rows.Scan(&id)
-		if err != nil {
-			return "", err
-		}
+	if progress == nil {
+		progress = func(done, total int) {}
 	}
+	if onChunk == nil {
+		onChunk = func(audio.Chunk, Transcript) {}
+	}
+	progress(0, len(chunks))
 
-	client := s3.NewFromConfig(cfg)
-	presignClient := s3.NewPresignClient(client)
-	req, err := presignClient.PresignPutObject(context.TODO(), &s3.PutObjectInput{
-		Bucket: aws.String(us.config.Bucket),
-		Key:    aws.String(createFileName(id+1, userId)),
-	})
-
-	fmt.Println("Presigned URL:", req)
+	// The diarizer hears the whole recording while the chunks are transcribed
+	diarizeCtx, cancelDiarize := context.WithCancel(ctx)
+	defer cancelDiarize()
+	var turns []SpeakerTurn
+	diarized := make(chan struct{})
+	go func() {
+		defer close(diarized)
+		turns = us.diarize(diarizeCtx, data, filename)
+	}()
 
+	parts, err := us.transcribeChunks(ctx, chunks, filename, progress, onChunk)
 	if err != nil {
-		log.Println("error:", err)
-		return "", err
+		cancelDiarize()
+		<-diarized
+		return Transcript{}, err
 	}
+	<-diarized
+
+	var st stitcher
+	for i, part := range parts {
+		st.add(part, chunks[i])
+	}
+	transcript := st.transcript
+
+	assignSpeakers(transcript.Segments, turns)
+	numberSpeakers(transcript.Segments)
+
+	transcript.Language = us.transcriptLanguage(parts, chunks)
 
-	return req.URL, nil
+	return transcript, nil
 }
 
-func (us *UserService) RetryTranscription(recordingId int, userId string) {
-	exists := us.recordingRepo.GetRecordingById(recordingId)
-	// Create filename
-	if !exists {
-		fmt.Println("Recording does not exist")
-		return
+// transcriptLanguage returns the language the recording was transcribed in:
+// the one detected in most of it, or else the one we asked for.
+func (us *UserService) transcriptLanguage(parts []Transcript, chunks []audio.Chunk) string {
+	if language := spokenLanguage(parts, chunks); language != "" {
+		return language
 	}
-	filename := fmt.Sprintf("%s-%d", userId, recordingId)
-	// download the file from S3 and call transcribe on it
-	us.downloadFromS3(filename)
-	// transcribe
-	file, err := os.Open(filename)
-	if err != nil {
-		fmt.Println("Error opening file")
-		return
+	// Backends that don't report it transcribed in the language they were given
+	if language, _ := normalizeLanguage(us.config.TranscriptionLanguage); language != LanguageAuto {
+		return language
 	}
-	defer file.Close()
-	// Transcribe the whole file
-	transcription, err := chunkedTranscription(file)
-	if err != nil {
-		fmt.Println("Error transcribing file")
-		return
-	}
-	// Call Llama API
-	llamaRespBody, statusCode, err := us.callLlamaAPI(transcription)
-	if err != nil {
-		fmt.Println("Error calling Llama API")
-		return
-	}
-	fmt.Println("Llama API response: ", llamaRespBody, statusCode)
-
+	return ""
 }
 
-func chunkedTranscription(r io.Reader) (string, error) {
-	const chunkSize = 15 * 1024 * 1024 // 15 MB chunks
-	var transcript string
-
-	buffer := make([]byte, chunkSize)
-	chunkIndex := 0
-
-	for {
-		n, err := io.ReadFull(r, buffer)
-		if err == io.EOF || err == io.ErrUnexpectedEOF {
-			if n > 0 {
-				text, txErr := transcribeChunk(buffer[:n], chunkIndex)
-				if txErr != nil {
-					return "", txErr
-				}
-				transcript += text + " "
-			}
-			break
-		}
-		if err != nil {
-			return "", fmt.Errorf("error reading chunk: %v", err)
+// spokenLanguage returns the language detected in most of the recording. Each
+// chunk is detected on its own, so a few words in another language can throw
+// a short chunk off.
+func spokenLanguage(parts []Transcript, chunks []audio.Chunk) string {
+	heard := make(map[string]time.Duration)
+	for i, part := range parts {
+		if part.Language != "" {
+			heard[part.Language] += chunks[i].Duration
 		}
+	}
 
-		// We have a full chunk
-		text, txErr := transcribeChunk(buffer[:n], chunkIndex)
-		if txErr != nil {
-			return "", txErr
+	language, longest := "", time.Duration(-1)
+	for l, d := range heard {
+		if d > longest || (d == longest && l < language) {
+			language, longest = l, d
 		}
-		transcript += text + " "
-		chunkIndex++
 	}
-
-	return transcript, nil
+	return language
 }
 
-func transcribeChunk(chunk []byte, chunkIndex int) (string, error) {
-	// fmt.Println("chunk", chunkIndex, chunk)
-	// TODO: Call your LemonFox transcription API with this chunk:
-	// Example pseudo-call:
-	//   return callLemonFoxTranscription(chunk)
-	//
-	// For demonstration, we'll just return placeholder text:
-	return fmt.Sprintf("[transcribed-chunk-%d]", chunkIndex), nil
-}
-
-func (us *UserService) downloadFromS3(filename string) {
-	cfg, err := config.LoadDefaultConfig(context.TODO(),
-		config.WithRegion(us.config.Region),
-	)
+// diarize runs the configured Diarizer over the recording. Speaker labels are
+// a nice to have, so a failure is logged and the transcript goes on without.
+func (us *UserService) diarize(ctx context.Context, data []byte, filename string) []SpeakerTurn {
+	if us.diarizer == nil {
+		return nil
+	}
+	turns, err := us.diarizer.Diarize(ctx, bytes.NewReader(data), filepath.Base(filename))
 	if err != nil {
-		log.Println("error:", err)
-		return
+		log.Printf("error diarizing %s: %v", filename, err)
+		return nil
 	}
+	return turns
+}
 
-	client := s3.NewFromConfig(cfg)
+// transcribeChunks sends the chunks to the transcription backend with at most
+// TranscriptionConcurrency requests in flight and returns the transcripts in
+// chunk order. The first failure cancels every other request.
+func (us *UserService) transcribeChunks(ctx context.Context, chunks []audio.Chunk, filename string, progress func(done, total int), onChunk func(audio.Chunk, Transcript)) ([]Transcript, error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
 
-	downloader := manager.NewDownloader(client)
+	parts := make([]Transcript, len(chunks))
+	sem := make(chan struct{}, us.config.TranscriptionConcurrency)
 
-	// Create a file to store in the local system
-	file, err := os.Create(filename)
-	if err != nil {
-		log.Println("error:", err)
-		return
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	// Keeps progress reports in order even though chunks finish in any order
+	var progressMu sync.Mutex
+	done := 0
+
+dispatch:
+	for i, chunk := range chunks {
+		select {
+		case sem <- struct{}{}:
+		case <-ctx.Done():
+			break dispatch
+		}
+
+		wg.Add(1)
+		go func(i int, chunk audio.Chunk) {
+			defer wg.Done()
+			defer func() { <-sem }()
+
+			part, err := us.transcribeChunk(ctx, chunk, filename)
+			if err != nil {
+				once.Do(func() {
+					firstErr = err
+					cancel()
+				})
+				return
+			}
+			parts[i] = part
+
+			progressMu.Lock()
+			onChunk(chunk, part)
+			done++
+			progress(done, len(chunks))
+			progressMu.Unlock()
+		}(i, chunk)
 	}
+	wg.Wait()
 
-	_, err = downloader.Download(context.TODO(), file, &s3.GetObjectInput{
-		Bucket: aws.String(us.config.Bucket),
-		Key:    aws.String(filename),
-	})
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	// The caller gave up before we sent everything
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return parts, nil
+}
 
+// transcribeChunk sends a single chunk of the recording to the transcription backend.
+func (us *UserService) transcribeChunk(ctx context.Context, chunk audio.Chunk, filename string) (Transcript, error) {
+	part, err := us.transcriber.Transcribe(ctx, bytes.NewReader(chunk.Data), chunkFileName(chunk, filename))
 	if err != nil {
-		log.Println("error:", err)
-		return
+		return Transcript{}, fmt.Errorf("error transcribing chunk %d: %v", chunk.Index, err)
 	}
+	return part, nil
 }
 
-func createFileName(id int, userId string) string {
-	return fmt.Sprintf("%d-%s", id, userId)
+// chunkFileName names a chunk after the original upload, with the extension of
+// the chunk's real format so the transcription API can tell what it is.
+func chunkFileName(chunk audio.Chunk, filename string) string {
+	name := filepath.Base(filename)
+	if chunk.Format != audio.FormatUnknown {
+		name = strings.TrimSuffix(name, filepath.Ext(name)) + "." + string(chunk.Format)
+	}
+	return fmt.Sprintf("%d-%s", chunk.Index, name)
 }
@@ -0,0 +1,222 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+)
+
+// fakeTranscriber answers every chunk with transcribe, called with the index
+// the chunk's file name starts with.
+type fakeTranscriber struct {
+	transcribe func(ctx context.Context, index int, data []byte) (Transcript, error)
+
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeTranscriber) Transcribe(ctx context.Context, r io.Reader, filename string) (Transcript, error) {
+	f.mu.Lock()
+	f.calls = append(f.calls, filename)
+	f.mu.Unlock()
+
+	index, err := strconv.Atoi(strings.SplitN(filename, "-", 2)[0])
+	if err != nil {
+		return Transcript{}, fmt.Errorf("chunk file name %q has no index", filename)
+	}
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return Transcript{}, err
+	}
+	return f.transcribe(ctx, index, data)
+}
+
+func testService(transcriber Transcriber, concurrency int) *UserService {
+	return &UserService{
+		config:      &Config{TranscriptionConcurrency: concurrency},
+		transcriber: transcriber,
+	}
+}
+
+func TestTranscribeChunks(t *testing.T) {
+	chunks := make([]audio.Chunk, 5)
+	for i := range chunks {
+		chunks[i] = audio.Chunk{Index: i, Format: audio.FormatWAV, Data: []byte{byte(i)}, Offset: time.Duration(i) * time.Minute, Duration: time.Minute}
+	}
+	errBackend := errors.New("backend down")
+
+	tests := []struct {
+		name        string
+		concurrency int
+		transcribe  func(ctx context.Context, index int, data []byte) (Transcript, error)
+		wantErr     error
+	}{
+		{
+			name:        "one at a time",
+			concurrency: 1,
+			transcribe: func(ctx context.Context, index int, data []byte) (Transcript, error) {
+				return Transcript{Text: fmt.Sprintf("chunk %d", data[0])}, nil
+			},
+		},
+		{
+			name:        "later chunks finish first",
+			concurrency: 5,
+			transcribe: func(ctx context.Context, index int, data []byte) (Transcript, error) {
+				time.Sleep(time.Duration(5-index) * 10 * time.Millisecond)
+				return Transcript{Text: fmt.Sprintf("chunk %d", data[0])}, nil
+			},
+		},
+		{
+			name:        "a failure cancels the rest",
+			concurrency: 2,
+			transcribe: func(ctx context.Context, index int, data []byte) (Transcript, error) {
+				if index == 1 {
+					return Transcript{}, errBackend
+				}
+				select {
+				case <-ctx.Done():
+					return Transcript{}, ctx.Err()
+				case <-time.After(time.Second):
+					return Transcript{Text: fmt.Sprintf("chunk %d", data[0])}, nil
+				}
+			},
+			wantErr: errBackend,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fake := &fakeTranscriber{transcribe: tt.transcribe}
+			us := testService(fake, tt.concurrency)
+
+			var progress [][2]int
+			var heard []int
+			started := time.Now()
+			parts, err := us.transcribeChunks(context.Background(), chunks, "meeting.mp3",
+				func(done, total int) { progress = append(progress, [2]int{done, total}) },
+				func(chunk audio.Chunk, part Transcript) { heard = append(heard, chunk.Index) },
+			)
+
+			if tt.wantErr != nil {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr.Error()) {
+					t.Fatalf("err = %v, want %v", err, tt.wantErr)
+				}
+				if elapsed := time.Since(started); elapsed >= time.Second {
+					t.Errorf("took %v, the other chunks weren't cancelled", elapsed)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// Parts come back in chunk order whatever order they finish in
+			for i, part := range parts {
+				if want := fmt.Sprintf("chunk %d", i); part.Text != want {
+					t.Errorf("part %d = %q, want %q", i, part.Text, want)
+				}
+			}
+			if len(heard) != len(chunks) {
+				t.Errorf("onChunk heard %v", heard)
+			}
+			for i, p := range progress {
+				if p != [2]int{i + 1, len(chunks)} {
+					t.Errorf("progress = %v, want 1..%d of %d in order", progress, len(chunks), len(chunks))
+					break
+				}
+			}
+			for _, name := range fake.calls {
+				if !strings.HasSuffix(name, "-meeting.wav") {
+					t.Errorf("chunk sent as %q", name)
+				}
+			}
+		})
+	}
+}
+
+func TestChunkedTranscription(t *testing.T) {
+	// 21 minutes of silence: three chunks at the default 10 minute target,
+	// the same cut audio.Split makes for the pipeline
+	pcm := audio.PCM{SampleRate: 8000, Channels: 1, BitsPerSample: 16}
+	data := pcm.WAV(make([]byte, pcm.Bytes(21*time.Minute)))
+	chunks, err := audio.Split(data, audio.DefaultOptions())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(chunks) != 3 {
+		t.Fatalf("got %d chunks, the test needs 3", len(chunks))
+	}
+
+	// The recording says a word every half second, w0 w1 w2 ..., in
+	// segments of 7 seconds, so segments straddle the cuts. Every chunk
+	// hears the words inside it, timed from its own start.
+	const wordEvery = 500 * time.Millisecond
+	const segmentEvery = 7 * time.Second
+	words := int(21 * time.Minute / wordEvery)
+	transcribe := func(ctx context.Context, index int, _ []byte) (Transcript, error) {
+		chunk := chunks[index]
+		end := chunk.Offset + chunk.Duration
+
+		// Chunks finish in reverse
+		time.Sleep(time.Duration(len(chunks)-index) * 20 * time.Millisecond)
+
+		var part Transcript
+		var segment *TranscriptSegment
+		for w := 0; w < words; w++ {
+			at := time.Duration(w) * wordEvery
+			if at < chunk.Offset || at >= end {
+				continue
+			}
+			bucket := at / segmentEvery * segmentEvery
+			if segment == nil || segment.Start != max(bucket, chunk.Offset)-chunk.Offset {
+				part.Segments = append(part.Segments, TranscriptSegment{
+					Start: max(bucket, chunk.Offset) - chunk.Offset,
+					End:   min(bucket+segmentEvery, end) - chunk.Offset,
+				})
+				segment = &part.Segments[len(part.Segments)-1]
+			}
+			segment.Text = strings.TrimSpace(segment.Text + " w" + strconv.Itoa(w))
+		}
+		return part, nil
+	}
+
+	us := testService(&fakeTranscriber{transcribe: transcribe}, 3)
+	transcript, err := us.chunkedTranscription(context.Background(), bytes.NewReader(data), "meeting.wav", nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Every word once, in order, although the chunks overlap
+	want := make([]string, words)
+	for w := range want {
+		want[w] = "w" + strconv.Itoa(w)
+	}
+	if got := strings.Fields(transcript.Text); strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Fatalf("transcript has %d words, want %d in order without repeats", len(got), words)
+	}
+
+	// Segments follow each other in recording time and hold the same words
+	var joined []string
+	var covered time.Duration
+	for i, s := range transcript.Segments {
+		if s.Start < covered || s.End <= s.Start {
+			t.Errorf("segment %d spans %v-%v, after %v", i, s.Start, s.End, covered)
+		}
+		covered = s.End
+		joined = append(joined, s.Text)
+	}
+	if strings.Join(joined, " ") != transcript.Text {
+		t.Error("segments don't add up to the transcript")
+	}
+	if covered != 21*time.Minute {
+		t.Errorf("segments end at %v, want 21m", covered)
+	}
+}
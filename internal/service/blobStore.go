@@ -0,0 +1,121 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+
+	"github.com/cyberhawk12121/Saarthi/internal/storage"
+	"golang.org/x/crypto/hkdf"
+)
+
+// Storage backends for StorageBackend
+const (
+	StorageBackendS3     = "s3"
+	StorageBackendLocal  = "local"
+	StorageBackendMemory = "memory"
+)
+
+// NewBlobStore builds the BlobStore picked by config.StorageBackend.
+func NewBlobStore(config *Config) (storage.BlobStore, error) {
+	key, err := storageSigningKey(config)
+	if err != nil {
+		return nil, err
+	}
+	signer := storage.NewURLSigner(config.StoragePublicURL, key)
+
+	switch config.StorageBackend {
+	case "", StorageBackendS3:
+		return storage.NewS3Store(context.Background(), storage.S3Options{
+			Region:          config.Region,
+			Bucket:          config.Bucket,
+			AccessKeyID:     config.AWSAccessKeyID,
+			SecretAccessKey: config.AWSSecretAccessKey,
+			Endpoint:        config.S3Endpoint,
+			ForcePathStyle:  config.S3ForcePathStyle,
+			PartSize:        config.S3PartSize,
+			Concurrency:     config.S3UploadConcurrency,
+		})
+	case StorageBackendLocal:
+		return storage.NewLocalStore(config.StorageLocalPath, signer)
+	case StorageBackendMemory:
+		return storage.NewMemoryStore(signer), nil
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", config.StorageBackend)
+	}
+}
+
+// storageSigningKey returns STORAGE_SIGNING_KEY, or else a key derived from
+// JWTSecret with HKDF, so URLs and tokens are never signed with the same key.
+func storageSigningKey(config *Config) ([]byte, error) {
+	if config.StorageSigningKey != "" {
+		return []byte(config.StorageSigningKey), nil
+	}
+	if config.JWTSecret == "" {
+		return nil, errors.New("STORAGE_SIGNING_KEY or JWT_SECRET must be set")
+	}
+	key := make([]byte, 32)
+	kdf := hkdf.New(sha256.New, []byte(config.JWTSecret), nil, []byte("saarthi storage url signing"))
+	if _, err := io.ReadFull(kdf, key); err != nil {
+		return nil, fmt.Errorf("error deriving storage signing key: %v", err)
+	}
+	return key, nil
+}
+
+// PutSignedObject stores the body of a request made to a URL presigned by the
+// local or memory backend, as long as the upload hasn't been completed. S3
+// URLs never reach us, so with S3 every request is refused.
+func (us *UserService) PutSignedObject(ctx context.Context, key string, query url.Values, body io.Reader) (storage.ObjectInfo, error) {
+	signed, ok := us.store.(storage.SignedStore)
+	if !ok {
+		return storage.ObjectInfo{}, storage.ErrInvalidSignature
+	}
+	if err := signed.Verify(http.MethodPut, key, query); err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	// The URL stays valid until it expires, but once the upload is complete
+	// the audio must not change under the job reading it
+	recording, err := us.recordingRepo.GetRecordingByStorageKey(key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return storage.ObjectInfo{}, storage.ErrInvalidKey
+	}
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	if recording.Uploaded {
+		return storage.ObjectInfo{}, ErrAlreadyUploaded
+	}
+
+	// Read one byte past the limit so we can tell a file that is too big
+	info, err := signed.Put(ctx, key, io.LimitReader(body, maxUploadSize+1))
+	if err != nil {
+		return storage.ObjectInfo{}, err
+	}
+	if info.Size > maxUploadSize {
+		signed.Delete(ctx, key)
+		return storage.ObjectInfo{}, ErrUploadTooLarge
+	}
+	return info, nil
+}
+
+// GetSignedObject opens the object behind a presigned GET URL of the local or
+// memory backend.
+func (us *UserService) GetSignedObject(ctx context.Context, key string, query url.Values) (io.ReadCloser, error) {
+	signed, ok := us.store.(storage.SignedStore)
+	if !ok {
+		return nil, storage.ErrInvalidSignature
+	}
+	if err := signed.Verify(http.MethodGet, key, query); err != nil {
+		return nil, err
+	}
+	rc, err := signed.Get(ctx, key)
+	if errors.Is(err, storage.ErrInvalidKey) {
+		return nil, storage.ErrNotFound
+	}
+	return rc, err
+}
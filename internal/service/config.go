@@ -1,6 +1,14 @@
 package service
 
-import "github.com/spf13/viper"
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/spf13/viper"
+)
 
 type Config struct {
 	LlamaAPIKey        string `mapstructure:"llama_api_key"`
@@ -10,6 +18,97 @@ type Config struct {
 	AWSAccessKeyID     string `mapstructure:"aws_access_key_id"`
 	AWSSecretAccessKey string `mapstructure:"aws_secret_access_key"`
 	LemonFoxAPIKey     string `mapstructure:"lemonfox_api_key"`
+	LemonFoxBaseURL    string `mapstructure:"lemonfox_base_url"`
+
+	// TranscriptionProvider picks the Transcriber backend: lemonfox (default), openai or whispercpp
+	TranscriptionProvider string `mapstructure:"transcription_provider"`
+	// TranscriptionBaseURL, TranscriptionAPIKey and TranscriptionModel configure the openai and whispercpp backends
+	TranscriptionBaseURL string `mapstructure:"transcription_base_url"`
+	TranscriptionAPIKey  string `mapstructure:"transcription_api_key"`
+	TranscriptionModel   string `mapstructure:"transcription_model"`
+	// TranscriptionLanguage overrides the backend's default language when set, "auto" detects it
+	TranscriptionLanguage string `mapstructure:"transcription_language"`
+	// TranscriptionConcurrency caps how many chunks are sent to the transcription backend at once
+	TranscriptionConcurrency int `mapstructure:"transcription_concurrency"`
+	// TranscriptionDiarize asks backends that can tell speakers apart (lemonfox) to label them
+	TranscriptionDiarize bool `mapstructure:"transcription_diarize"`
+
+	// DiarizerProvider picks the Diarizer used on the whole recording: none (default) or http
+	DiarizerProvider string `mapstructure:"diarizer_provider"`
+	DiarizerBaseURL  string `mapstructure:"diarizer_base_url"`
+
+	// SummarizerProvider picks the Summarizer backend: llama (default), openai or ollama
+	SummarizerProvider string `mapstructure:"summarizer_provider"`
+	SummarizerModel    string `mapstructure:"summarizer_model"`
+	SummarizerBaseURL  string `mapstructure:"summarizer_base_url"`
+	// SummarizerAPIKey falls back to LlamaAPIKey for the llama provider
+	SummarizerAPIKey string `mapstructure:"summarizer_api_key"`
+	// SummarizerTokenBudget is how many tokens (prompt and reply) we send the
+	// model in one request. Longer transcripts are summarized part by part.
+	SummarizerTokenBudget int `mapstructure:"summarizer_token_budget"`
+	// SummarizerTokenBudgets overrides the budget per model, set as
+	// SUMMARIZER_TOKEN_BUDGETS=gpt-4o-mini=120000,llama3.1=8000
+	SummarizerTokenBudgets map[string]int `mapstructure:"summarizer_token_budgets"`
+
+	// ResourceProvider picks the ResourceProvider that finds links on the
+	// topics of a meeting: none (default), searxng or static
+	ResourceProvider string `mapstructure:"resource_provider"`
+	// ResourceBaseURL is where the searxng instance is
+	ResourceBaseURL string `mapstructure:"resource_base_url"`
+	// ResourceStaticFile is the JSON list of resources the static provider searches
+	ResourceStaticFile string `mapstructure:"resource_static_file"`
+	// ResourceTopics and ResourcesPerTopic cap how much is looked up per meeting
+	ResourceTopics    int `mapstructure:"resource_topics"`
+	ResourcesPerTopic int `mapstructure:"resources_per_topic"`
+
+	// JWTSecret signs the access and refresh tokens
+	JWTSecret       string        `mapstructure:"jwt_secret"`
+	AccessTokenTTL  time.Duration `mapstructure:"access_token_ttl"`
+	RefreshTokenTTL time.Duration `mapstructure:"refresh_token_ttl"`
+	// StreamTokenTTL is how long the tokens browsers open event streams and
+	// live sessions with stay valid
+	StreamTokenTTL time.Duration `mapstructure:"stream_token_ttl"`
+
+	// StorageBackend picks the BlobStore: s3 (default), local or memory
+	StorageBackend string `mapstructure:"storage_backend"`
+	// StorageLocalPath is the directory the local backend keeps recordings in
+	StorageLocalPath string `mapstructure:"storage_local_path"`
+	// StoragePublicURL is where this API is reachable, the local and memory
+	// backends presign URLs under it
+	StoragePublicURL string `mapstructure:"storage_public_url"`
+	// StorageSigningKey signs those URLs. Without it a key is derived from
+	// JWTSecret, never the secret itself.
+	StorageSigningKey string `mapstructure:"storage_signing_key"`
+
+	// S3Endpoint and S3ForcePathStyle are for S3-compatible stores such as MinIO
+	S3Endpoint       string `mapstructure:"s3_endpoint"`
+	S3ForcePathStyle bool   `mapstructure:"s3_force_path_style"`
+	// S3PartSize and S3UploadConcurrency tune the streaming multipart upload
+	S3PartSize          int64 `mapstructure:"s3_part_size"`
+	S3UploadConcurrency int   `mapstructure:"s3_upload_concurrency"`
+
+	// HTTPTimeout limits every attempt of a call to a transcription or summarizer provider
+	HTTPTimeout time.Duration `mapstructure:"http_timeout"`
+	// HTTPMaxRetries, HTTPRetryBaseDelay and HTTPRetryMaxDelay control the retries
+	// of failed provider calls (transport errors, 408, 429 and 5xx)
+	HTTPMaxRetries     int           `mapstructure:"http_max_retries"`
+	HTTPRetryBaseDelay time.Duration `mapstructure:"http_retry_base_delay"`
+	HTTPRetryMaxDelay  time.Duration `mapstructure:"http_retry_max_delay"`
+	// BreakerFailureThreshold failures in a row open a provider's circuit
+	// breaker for BreakerOpenTimeout
+	BreakerFailureThreshold int           `mapstructure:"breaker_failure_threshold"`
+	BreakerOpenTimeout      time.Duration `mapstructure:"breaker_open_timeout"`
+
+	// PresignTTL is how long presigned upload URLs stay valid
+	PresignTTL time.Duration `mapstructure:"presign_ttl"`
+
+	// LiveWindow is how much audio of a live session is transcribed at a time
+	LiveWindow time.Duration `mapstructure:"live_window"`
+	// LiveMaxDuration ends live sessions that run longer
+	LiveMaxDuration time.Duration `mapstructure:"live_max_duration"`
+	// LiveAllowedOrigins are the pages besides our own that may open live
+	// sessions, set as LIVE_ALLOWED_ORIGINS=https://app.example.com,... or *
+	LiveAllowedOrigins []string `mapstructure:"live_allowed_origins"`
 }
 
 func LoadConfig() (config *Config, err error) {
@@ -18,6 +117,33 @@ func LoadConfig() (config *Config, err error) {
 	v.SetConfigType("env")
 	v.AddConfigPath(".")
 	v.AutomaticEnv()
+	v.SetDefault("LEMONFOX_BASE_URL", defaultLemonFoxBaseURL)
+	v.SetDefault("TRANSCRIPTION_PROVIDER", TranscriptionProviderLemonFox)
+	v.SetDefault("TRANSCRIPTION_CONCURRENCY", 4)
+	v.SetDefault("DIARIZER_PROVIDER", DiarizerProviderNone)
+	v.SetDefault("DIARIZER_BASE_URL", defaultDiarizerBaseURL)
+	v.SetDefault("SUMMARIZER_PROVIDER", SummarizerProviderLlama)
+	v.SetDefault("SUMMARIZER_TOKEN_BUDGET", 8000)
+	v.SetDefault("RESOURCE_PROVIDER", ResourceProviderNone)
+	v.SetDefault("RESOURCE_TOPICS", 3)
+	v.SetDefault("RESOURCES_PER_TOPIC", 3)
+	v.SetDefault("ACCESS_TOKEN_TTL", 15*time.Minute)
+	v.SetDefault("REFRESH_TOKEN_TTL", 30*24*time.Hour)
+	v.SetDefault("STREAM_TOKEN_TTL", 10*time.Minute)
+	v.SetDefault("PRESIGN_TTL", 15*time.Minute)
+	v.SetDefault("HTTP_TIMEOUT", 5*time.Minute)
+	v.SetDefault("HTTP_MAX_RETRIES", 3)
+	v.SetDefault("HTTP_RETRY_BASE_DELAY", 500*time.Millisecond)
+	v.SetDefault("HTTP_RETRY_MAX_DELAY", 30*time.Second)
+	v.SetDefault("BREAKER_FAILURE_THRESHOLD", 5)
+	v.SetDefault("BREAKER_OPEN_TIMEOUT", 30*time.Second)
+	v.SetDefault("STORAGE_BACKEND", StorageBackendS3)
+	v.SetDefault("STORAGE_LOCAL_PATH", "data/recordings")
+	v.SetDefault("STORAGE_PUBLIC_URL", "http://localhost:8080")
+	v.SetDefault("S3_PART_SIZE", manager.DefaultUploadPartSize)
+	v.SetDefault("S3_UPLOAD_CONCURRENCY", manager.DefaultUploadConcurrency)
+	v.SetDefault("LIVE_WINDOW", 15*time.Second)
+	v.SetDefault("LIVE_MAX_DURATION", 4*time.Hour)
 
 	if err := v.ReadInConfig(); err != nil {
 		return &Config{}, err
@@ -30,6 +156,93 @@ func LoadConfig() (config *Config, err error) {
 	c.AWSSecretAccessKey = v.GetString("AWS_SECRET_ACCESS_KEY")
 	c.LlamaAPIKey = v.GetString("LLAMA_API_KEY")
 	c.LemonFoxAPIKey = v.GetString("LEMONFOX_API_KEY")
+	c.LemonFoxBaseURL = v.GetString("LEMONFOX_BASE_URL")
+	c.TranscriptionProvider = v.GetString("TRANSCRIPTION_PROVIDER")
+	c.TranscriptionBaseURL = v.GetString("TRANSCRIPTION_BASE_URL")
+	c.TranscriptionAPIKey = v.GetString("TRANSCRIPTION_API_KEY")
+	c.TranscriptionModel = v.GetString("TRANSCRIPTION_MODEL")
+	c.TranscriptionLanguage = v.GetString("TRANSCRIPTION_LANGUAGE")
+	c.TranscriptionConcurrency = v.GetInt("TRANSCRIPTION_CONCURRENCY")
+	if c.TranscriptionConcurrency < 1 {
+		c.TranscriptionConcurrency = 1
+	}
+	c.TranscriptionDiarize = v.GetBool("TRANSCRIPTION_DIARIZE")
+	c.DiarizerProvider = v.GetString("DIARIZER_PROVIDER")
+	c.DiarizerBaseURL = v.GetString("DIARIZER_BASE_URL")
+	c.SummarizerProvider = v.GetString("SUMMARIZER_PROVIDER")
+	c.SummarizerModel = v.GetString("SUMMARIZER_MODEL")
+	c.SummarizerBaseURL = v.GetString("SUMMARIZER_BASE_URL")
+	c.SummarizerAPIKey = v.GetString("SUMMARIZER_API_KEY")
+	c.SummarizerTokenBudget = v.GetInt("SUMMARIZER_TOKEN_BUDGET")
+	c.SummarizerTokenBudgets, err = parseTokenBudgets(v.GetString("SUMMARIZER_TOKEN_BUDGETS"))
+	if err != nil {
+		return &Config{}, err
+	}
+	c.ResourceProvider = v.GetString("RESOURCE_PROVIDER")
+	c.ResourceBaseURL = v.GetString("RESOURCE_BASE_URL")
+	c.ResourceStaticFile = v.GetString("RESOURCE_STATIC_FILE")
+	c.ResourceTopics = v.GetInt("RESOURCE_TOPICS")
+	c.ResourcesPerTopic = v.GetInt("RESOURCES_PER_TOPIC")
+	c.JWTSecret = v.GetString("JWT_SECRET")
+	c.AccessTokenTTL = v.GetDuration("ACCESS_TOKEN_TTL")
+	c.RefreshTokenTTL = v.GetDuration("REFRESH_TOKEN_TTL")
+	c.StreamTokenTTL = v.GetDuration("STREAM_TOKEN_TTL")
+	c.PresignTTL = v.GetDuration("PRESIGN_TTL")
+	c.HTTPTimeout = v.GetDuration("HTTP_TIMEOUT")
+	c.HTTPMaxRetries = v.GetInt("HTTP_MAX_RETRIES")
+	c.HTTPRetryBaseDelay = v.GetDuration("HTTP_RETRY_BASE_DELAY")
+	c.HTTPRetryMaxDelay = v.GetDuration("HTTP_RETRY_MAX_DELAY")
+	c.BreakerFailureThreshold = v.GetInt("BREAKER_FAILURE_THRESHOLD")
+	c.BreakerOpenTimeout = v.GetDuration("BREAKER_OPEN_TIMEOUT")
+	c.StorageBackend = v.GetString("STORAGE_BACKEND")
+	c.StorageLocalPath = v.GetString("STORAGE_LOCAL_PATH")
+	c.StoragePublicURL = v.GetString("STORAGE_PUBLIC_URL")
+	c.StorageSigningKey = v.GetString("STORAGE_SIGNING_KEY")
+	c.S3Endpoint = v.GetString("S3_ENDPOINT")
+	c.S3ForcePathStyle = v.GetBool("S3_FORCE_PATH_STYLE")
+	c.S3PartSize = v.GetInt64("S3_PART_SIZE")
+	// S3 rejects parts smaller than 5MB (except the last one)
+	if c.S3PartSize < manager.MinUploadPartSize {
+		c.S3PartSize = manager.MinUploadPartSize
+	}
+	c.S3UploadConcurrency = v.GetInt("S3_UPLOAD_CONCURRENCY")
+	if c.S3UploadConcurrency < 1 {
+		c.S3UploadConcurrency = 1
+	}
+	c.LiveWindow = v.GetDuration("LIVE_WINDOW")
+	// Shorter windows are mostly overlap and cut words apart
+	if c.LiveWindow < 5*time.Second {
+		c.LiveWindow = 5 * time.Second
+	}
+	c.LiveMaxDuration = v.GetDuration("LIVE_MAX_DURATION")
+	if c.LiveMaxDuration <= 0 {
+		c.LiveMaxDuration = 4 * time.Hour
+	}
+	for _, origin := range strings.Split(v.GetString("LIVE_ALLOWED_ORIGINS"), ",") {
+		if origin = strings.TrimRight(strings.TrimSpace(origin), "/"); origin != "" {
+			c.LiveAllowedOrigins = append(c.LiveAllowedOrigins, origin)
+		}
+	}
 
 	return &c, nil
 }
+
+// parseTokenBudgets reads a comma separated list of model=tokens pairs.
+func parseTokenBudgets(value string) (map[string]int, error) {
+	budgets := make(map[string]int)
+	for _, pair := range strings.Split(value, ",") {
+		if strings.TrimSpace(pair) == "" {
+			continue
+		}
+		i := strings.LastIndex(pair, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("invalid SUMMARIZER_TOKEN_BUDGETS entry %q, want model=tokens", pair)
+		}
+		tokens, err := strconv.Atoi(strings.TrimSpace(pair[i+1:]))
+		if err != nil || tokens <= 0 {
+			return nil, fmt.Errorf("invalid token budget in SUMMARIZER_TOKEN_BUDGETS entry %q", pair)
+		}
+		budgets[strings.TrimSpace(pair[:i])] = tokens
+	}
+	return budgets, nil
+}
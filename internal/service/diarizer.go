@@ -0,0 +1,203 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+// Diarizer tells who speaks when in a recording. It is the fallback for
+// transcription backends that don't label speakers themselves, and it wins
+// over their labels when configured, since it hears the whole recording
+// instead of one chunk at a time. Backends are picked with DIARIZER_PROVIDER.
+type Diarizer interface {
+	Diarize(ctx context.Context, audio io.Reader, filename string) ([]SpeakerTurn, error)
+}
+
+// SpeakerTurn is a stretch of the recording where one speaker talks.
+type SpeakerTurn struct {
+	Start   time.Duration
+	End     time.Duration
+	Speaker string
+}
+
+const (
+	DiarizerProviderNone = "none"
+	DiarizerProviderHTTP = "http"
+)
+
+const defaultDiarizerBaseURL = "http://localhost:8082"
+
+// NewDiarizer builds the diarization backend selected in the config, or
+// returns nil if there is none.
+func NewDiarizer(config *Config) (Diarizer, error) {
+	switch config.DiarizerProvider {
+	case "", DiarizerProviderNone:
+		return nil, nil
+	case DiarizerProviderHTTP:
+		d := NewHTTPDiarizer(config.DiarizerBaseURL)
+		d.HTTPClient = providerClient(d.HTTPClient.Name, httpOptions(config))
+		return d, nil
+	default:
+		return nil, fmt.Errorf("unknown diarizer provider %q", config.DiarizerProvider)
+	}
+}
+
+// HTTPDiarizer talks to a local diarization server (e.g. pyannote behind a
+// small HTTP wrapper). It posts the audio to /diarize and expects
+//
+//	{"segments": [{"start": 0.0, "end": 4.2, "speaker": "SPEAKER_00"}, ...]}
+type HTTPDiarizer struct {
+	BaseURL    string
+	HTTPClient *httpclient.Client
+}
+
+func NewHTTPDiarizer(baseURL string) *HTTPDiarizer {
+	if baseURL == "" {
+		baseURL = defaultDiarizerBaseURL
+	}
+	return &HTTPDiarizer{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: providerClient("Diarizer", httpclient.DefaultOptions()),
+	}
+}
+
+func (hd *HTTPDiarizer) Diarize(ctx context.Context, audio io.Reader, filename string) ([]SpeakerTurn, error) {
+	respBody, err := postAudio(ctx, hd.HTTPClient, "Diarizer", hd.BaseURL+"/diarize", "", audio, filename, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var reply struct {
+		Segments []struct {
+			Start   float64 `json:"start"`
+			End     float64 `json:"end"`
+			Speaker string  `json:"speaker"`
+		} `json:"segments"`
+	}
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return nil, fmt.Errorf("error parsing Diarizer JSON: %v", err)
+	}
+
+	turns := make([]SpeakerTurn, 0, len(reply.Segments))
+	for _, s := range reply.Segments {
+		if s.Speaker == "" || s.End <= s.Start {
+			continue
+		}
+		turns = append(turns, SpeakerTurn{Start: seconds(s.Start), End: seconds(s.End), Speaker: s.Speaker})
+	}
+	return turns, nil
+}
+
+// assignSpeakers gives every segment the speaker of the turns it overlaps
+// most, replacing the labels of the transcription backend. Without turns the
+// segments are left alone.
+func assignSpeakers(segments []TranscriptSegment, turns []SpeakerTurn) {
+	if len(turns) == 0 {
+		return
+	}
+	for i := range segments {
+		talked := make(map[string]time.Duration)
+		for _, turn := range turns {
+			if d := overlap(segments[i].Start, segments[i].End, turn.Start, turn.End); d > 0 {
+				talked[turn.Speaker] += d
+			}
+		}
+
+		best, longest := "", time.Duration(0)
+		for speaker, d := range talked {
+			if d > longest || (d == longest && speaker < best) {
+				best, longest = speaker, d
+			}
+		}
+		segments[i].Speaker = best
+	}
+}
+
+// linkSpeakers maps the speaker labels of a chunk's segments to the labels
+// already in the transcript. A backend numbers the speakers of every chunk
+// on its own, so the only link between two chunks is the audio they share:
+// labels are paired by how long they talk over the same stretch of it, most
+// first. Labels that can't be paired get a new label unique to the chunk.
+func linkSpeakers(kept []TranscriptSegment, segments []TranscriptSegment, chunk int) map[string]string {
+	type pair struct {
+		local, global string
+		d             time.Duration
+	}
+
+	shared := make(map[[2]string]time.Duration)
+	for _, s := range segments {
+		if s.Speaker == "" {
+			continue
+		}
+		// Only the tail of the transcript can overlap this chunk
+		for i := len(kept) - 1; i >= 0 && kept[i].End > s.Start; i-- {
+			if kept[i].Speaker == "" {
+				continue
+			}
+			if d := overlap(s.Start, s.End, kept[i].Start, kept[i].End); d > 0 {
+				shared[[2]string{s.Speaker, kept[i].Speaker}] += d
+			}
+		}
+	}
+
+	pairs := make([]pair, 0, len(shared))
+	for k, d := range shared {
+		pairs = append(pairs, pair{local: k[0], global: k[1], d: d})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		if pairs[i].d != pairs[j].d {
+			return pairs[i].d > pairs[j].d
+		}
+		if pairs[i].local != pairs[j].local {
+			return pairs[i].local < pairs[j].local
+		}
+		return pairs[i].global < pairs[j].global
+	})
+
+	labels := make(map[string]string)
+	taken := make(map[string]bool)
+	for _, p := range pairs {
+		if _, ok := labels[p.local]; ok || taken[p.global] {
+			continue
+		}
+		labels[p.local] = p.global
+		taken[p.global] = true
+	}
+
+	for _, s := range segments {
+		if _, ok := labels[s.Speaker]; !ok && s.Speaker != "" {
+			labels[s.Speaker] = fmt.Sprintf("%d/%s", chunk, s.Speaker)
+		}
+	}
+	return labels
+}
+
+// numberSpeakers renames the speakers to "Speaker 1", "Speaker 2", ... in the
+// order they first talk.
+func numberSpeakers(segments []TranscriptSegment) {
+	names := make(map[string]string)
+	for i := range segments {
+		label := segments[i].Speaker
+		if label == "" {
+			continue
+		}
+		name, ok := names[label]
+		if !ok {
+			name = fmt.Sprintf("Speaker %d", len(names)+1)
+			names[label] = name
+		}
+		segments[i].Speaker = name
+	}
+}
+
+// overlap returns how long [aStart, aEnd) and [bStart, bEnd) share.
+func overlap(aStart, aEnd, bStart, bEnd time.Duration) time.Duration {
+	return max(0, min(aEnd, bEnd)-max(aStart, bStart))
+}
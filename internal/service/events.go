@@ -0,0 +1,77 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+	"github.com/cyberhawk12121/Saarthi/internal/events"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+// Event types of GET /recordings/:id/events, see the *Event types in shared.
+const (
+	EventStage        = "stage"
+	EventProgress     = "progress"
+	EventTranscript   = "transcript"
+	EventSummaryDelta = "summary_delta"
+	EventSummary      = "summary"
+)
+
+// RecordingEvents follows the events of the user's recording, starting after
+// lastEventId. The channel is closed once the run is over. Call cancel once
+// done.
+func (us *UserService) RecordingEvents(userId string, recordingId int, lastEventId int64) (<-chan events.Event, func(), error) {
+	recording, err := us.recordingRepo.GetRecording(recordingId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && recording.UserID != userId) {
+		return nil, nil, ErrRecordingNotFound
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// An uploaded recording without a running job has nothing more coming,
+	// the stream ends after what is kept instead of idling
+	if recording.Uploaded {
+		running, err := us.jobRepo.HasRunningJob(recordingId)
+		if err != nil {
+			return nil, nil, err
+		}
+		if !running {
+			return us.events.Replay(recordingId, lastEventId), func() {}, nil
+		}
+	}
+
+	ch, cancel := us.events.Subscribe(recordingId, lastEventId)
+	return ch, cancel, nil
+}
+
+// chunkTranscribed publishes the transcript of a chunk, in recording time.
+func (us *UserService) chunkTranscribed(jobId string, recordingId int) func(chunk audio.Chunk, part Transcript) {
+	return func(chunk audio.Chunk, part Transcript) {
+		event := types.TranscriptEvent{
+			JobID:    jobId,
+			Chunk:    chunk.Index,
+			Start:    chunk.Offset.Seconds(),
+			End:      (chunk.Offset + chunk.Duration).Seconds(),
+			Text:     part.Text,
+			Segments: make([]types.TranscriptSegment, 0, len(part.Segments)),
+		}
+		for _, s := range part.Segments {
+			event.Segments = append(event.Segments, types.TranscriptSegment{
+				Start: (chunk.Offset + s.Start).Seconds(),
+				End:   (chunk.Offset + s.End).Seconds(),
+				Text:  s.Text,
+			})
+		}
+		us.events.Publish(recordingId, EventTranscript, event)
+	}
+}
+
+// summaryDeltas publishes the summary while the LLM writes it. The pieces are
+// only useful live, so late subscribers don't get them.
+func (us *UserService) summaryDeltas(jobId string, recordingId int) func(string) {
+	return func(text string) {
+		us.events.PublishTransient(recordingId, EventSummaryDelta, types.SummaryDeltaEvent{JobID: jobId, Text: text})
+	}
+}
@@ -0,0 +1,95 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+// LanguageAuto lets the transcription backend detect the language itself.
+const LanguageAuto = "auto"
+
+// ErrUnsupportedLanguage is returned for a language the transcription backends don't know.
+var ErrUnsupportedLanguage = errors.New("unsupported language")
+
+// languageNames are the languages Whisper (and so every backend we have)
+// transcribes, by ISO 639-1 code.
+var languageNames = map[string]string{
+	"af": "Afrikaans", "ar": "Arabic", "hy": "Armenian", "az": "Azerbaijani",
+	"be": "Belarusian", "bs": "Bosnian", "bg": "Bulgarian", "ca": "Catalan",
+	"zh": "Chinese", "hr": "Croatian", "cs": "Czech", "da": "Danish",
+	"nl": "Dutch", "en": "English", "et": "Estonian", "fi": "Finnish",
+	"fr": "French", "gl": "Galician", "de": "German", "el": "Greek",
+	"he": "Hebrew", "hi": "Hindi", "hu": "Hungarian", "is": "Icelandic",
+	"id": "Indonesian", "it": "Italian", "ja": "Japanese", "kn": "Kannada",
+	"kk": "Kazakh", "ko": "Korean", "lv": "Latvian", "lt": "Lithuanian",
+	"mk": "Macedonian", "ms": "Malay", "mr": "Marathi", "mi": "Maori",
+	"ne": "Nepali", "no": "Norwegian", "fa": "Persian", "pl": "Polish",
+	"pt": "Portuguese", "ro": "Romanian", "ru": "Russian", "sr": "Serbian",
+	"sk": "Slovak", "sl": "Slovenian", "es": "Spanish", "sw": "Swahili",
+	"sv": "Swedish", "tl": "Tagalog", "ta": "Tamil", "th": "Thai",
+	"tr": "Turkish", "uk": "Ukrainian", "ur": "Urdu", "vi": "Vietnamese",
+	"cy": "Welsh", "bn": "Bengali", "gu": "Gujarati", "pa": "Punjabi",
+	"te": "Telugu", "ml": "Malayalam",
+}
+
+// normalizeLanguage turns a language code or English name ("de", "German",
+// "german") into its ISO 639-1 code. "auto" and "" are returned as they are.
+func normalizeLanguage(language string) (string, error) {
+	language = strings.ToLower(strings.TrimSpace(language))
+	if language == "" || language == LanguageAuto {
+		return language, nil
+	}
+	if _, ok := languageNames[language]; ok {
+		return language, nil
+	}
+	for code, name := range languageNames {
+		if strings.ToLower(name) == language {
+			return code, nil
+		}
+	}
+	return "", fmt.Errorf("%w: %q", ErrUnsupportedLanguage, language)
+}
+
+// languageName returns the English name of an ISO 639-1 code, or the code
+// itself if we don't know it.
+func languageName(code string) string {
+	if name, ok := languageNames[code]; ok {
+		return name
+	}
+	return code
+}
+
+// recordingLanguage picks the language of a new recording: the one asked for
+// on upload, or else the user's default. "" leaves it to TRANSCRIPTION_LANGUAGE.
+func (us *UserService) recordingLanguage(userId string, requested string) (string, error) {
+	language, err := normalizeLanguage(requested)
+	if err != nil || language != "" {
+		return language, err
+	}
+	return us.userRepo.GetUserLanguage(userId)
+}
+
+// GetPreferences returns the user's settings.
+func (us *UserService) GetPreferences(userId string) (types.Preferences, error) {
+	language, err := us.userRepo.GetUserLanguage(userId)
+	if err != nil {
+		return types.Preferences{}, err
+	}
+	return types.Preferences{Language: language}, nil
+}
+
+// UpdatePreferences replaces the user's settings, or returns
+// ErrUnsupportedLanguage.
+func (us *UserService) UpdatePreferences(userId string, prefs types.Preferences) (types.Preferences, error) {
+	language, err := normalizeLanguage(prefs.Language)
+	if err != nil {
+		return types.Preferences{}, err
+	}
+	if err := us.userRepo.SetUserLanguage(userId, language); err != nil {
+		return types.Preferences{}, err
+	}
+	return types.Preferences{Language: language}, nil
+}
@@ -1,86 +1,51 @@
 package service
 
 import (
-	"bytes"
-	"encoding/json"
-	"fmt"
+	"context"
 	"io"
-	"mime/multipart"
-	"net/http"
-)
-
-// callLemonFoxTranscription sends the uploaded file to LemonFox for transcription.
-func (us *UserService) callLemonFoxTranscription(file io.Reader, filename string) (string, error) {
-	//-------------------------------------------------------------------
-	// Build multipart/form-data body for LemonFox
-	//-------------------------------------------------------------------
-	var requestBody bytes.Buffer
-	writer := multipart.NewWriter(&requestBody)
-
-	// Add file field
-	part, err := writer.CreateFormFile("file", filename)
-	if err != nil {
-		return "", fmt.Errorf("unable to create form file for LemonFox: %v", err)
-	}
+	"strings"
 
-	// Copy file contents
-	if _, err := io.Copy(part, file); err != nil {
-		return "", fmt.Errorf("unable to copy file content: %v", err)
-	}
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
 
-	// Additional fields for LemonFox
-	if err := writer.WriteField("language", "english"); err != nil {
-		return "", fmt.Errorf("unable to add language field: %v", err)
-	}
-	if err := writer.WriteField("response_format", "json"); err != nil {
-		return "", fmt.Errorf("unable to add response_format field: %v", err)
-	}
+const defaultLemonFoxBaseURL = "https://api.lemonfox.ai/v1"
+
+// LemonFoxClient sends audio to the LemonFox transcription API. BaseURL can be
+// pointed at any server that speaks the same protocol (e.g. an httptest server).
+type LemonFoxClient struct {
+	BaseURL    string
+	APIKey     string
+	Language   string
+	HTTPClient *httpclient.Client
+	// SpeakerLabels asks LemonFox to tell the speakers apart
+	SpeakerLabels bool
+}
 
-	// Close writer
-	if err := writer.Close(); err != nil {
-		return "", fmt.Errorf("error closing LemonFox writer: %v", err)
+func NewLemonFoxClient(baseURL, apiKey string) *LemonFoxClient {
+	if baseURL == "" {
+		baseURL = defaultLemonFoxBaseURL
 	}
-
-	//-------------------------------------------------------------------
-	// Prepare and send HTTP request
-	//-------------------------------------------------------------------
-
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.lemonfox.ai/v1/audio/transcriptions",
-		&requestBody,
-	)
-	if err != nil {
-		return "", fmt.Errorf("error creating LemonFox request: %v", err)
+	return &LemonFoxClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Language:   "english",
+		HTTPClient: providerClient("LemonFox", httpclient.DefaultOptions()),
 	}
+}
 
-	req.Header.Set("Content-Type", writer.FormDataContentType())
-	req.Header.Set("Authorization", "Bearer "+us.config.LemonFoxAPIKey)
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return "", fmt.Errorf("error sending request to LemonFox: %v", err)
+// Transcribe sends the given audio to LemonFox and returns the timed segments of its transcription.
+func (lf *LemonFoxClient) Transcribe(ctx context.Context, file io.Reader, filename string) (Transcript, error) {
+	fields := map[string]string{
+		"language":        lf.Language,
+		"response_format": "verbose_json",
 	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != http.StatusOK {
-		bodyBytes, _ := io.ReadAll(resp.Body)
-		return "", fmt.Errorf("lemonFox returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	if lf.SpeakerLabels {
+		fields["speaker_labels"] = "true"
 	}
-
-	//-------------------------------------------------------------------
-	// Parse response
-	//-------------------------------------------------------------------
-	respBody, err := io.ReadAll(resp.Body)
+	respBody, err := postAudio(ctx, lf.HTTPClient, "LemonFox", lf.BaseURL+"/audio/transcriptions", lf.APIKey, file, filename, fields)
 	if err != nil {
-		return "", fmt.Errorf("error reading LemonFox response: %v", err)
-	}
-
-	var lemonFoxJSON LemonFoxResponse
-	if err := json.Unmarshal(respBody, &lemonFoxJSON); err != nil {
-		return "", fmt.Errorf("error parsing LemonFox JSON: %v", err)
+		return Transcript{}, err
 	}
 
-	return lemonFoxJSON.Text, nil
+	return parseVerboseTranscription("LemonFox", respBody)
 }
@@ -0,0 +1,212 @@
+package service
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+// lemonFoxRequest is what the stand-in server was sent.
+type lemonFoxRequest struct {
+	path          string
+	authorization string
+	fields        map[string]string
+	filename      string
+	audio         string
+}
+
+// newLemonFoxServer stands in for the LemonFox API, answering every
+// transcription with the given status and body.
+func newLemonFoxServer(t *testing.T, status int, reply string) (*httptest.Server, *lemonFoxRequest) {
+	got := &lemonFoxRequest{fields: make(map[string]string)}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got.path = r.URL.Path
+		got.authorization = r.Header.Get("Authorization")
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			t.Errorf("not a multipart form: %v", err)
+		}
+		for key := range r.MultipartForm.Value {
+			got.fields[key] = r.FormValue(key)
+		}
+		if file, header, err := r.FormFile("file"); err == nil {
+			audio, _ := io.ReadAll(file)
+			got.filename = header.Filename
+			got.audio = string(audio)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		io.WriteString(w, reply)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, got
+}
+
+// testProviderClient doesn't retry and has a breaker of its own, so tests
+// don't share state through httpclient.Breakers.
+func testProviderClient(srv *httptest.Server) *httpclient.Client {
+	return &httpclient.Client{
+		Name:    "LemonFox",
+		Options: httpclient.Options{Timeout: 5 * time.Second},
+		HTTP:    srv.Client(),
+		Breaker: httpclient.NewBreaker("LemonFox", 5, time.Minute),
+	}
+}
+
+func TestLemonFoxTranscribe(t *testing.T) {
+	tests := []struct {
+		name          string
+		status        int
+		reply         string
+		language      string
+		speakerLabels bool
+		wantErr       bool
+		wantFields    map[string]string
+		want          Transcript
+	}{
+		{
+			name:   "verbose_json segments",
+			status: http.StatusOK,
+			reply: `{"text": " Hello there. General Kenobi.", "language": "english", "duration": 4.2, "segments": [
+				{"start": 0.0, "end": 1.5, "text": " Hello there.", "avg_logprob": -0.1},
+				{"start": 1.5, "end": 4.2, "text": " General Kenobi.", "avg_logprob": 0.3}
+			]}`,
+			language:   "english",
+			wantFields: map[string]string{"language": "english", "response_format": "verbose_json"},
+			want: Transcript{
+				Text:     "Hello there. General Kenobi.",
+				Language: "en",
+				Segments: []TranscriptSegment{
+					{Start: 0, End: 1500 * time.Millisecond, Text: "Hello there.", Confidence: 0.9048374180359595},
+					{Start: 1500 * time.Millisecond, End: 4200 * time.Millisecond, Text: "General Kenobi.", Confidence: 1},
+				},
+			},
+		},
+		{
+			name:   "speaker labels",
+			status: http.StatusOK,
+			reply: `{"text": "Hi. Hello.", "language": "german", "segments": [
+				{"start": 0.0, "end": 1.0, "text": "Hi.", "speaker": "SPEAKER_00"},
+				{"start": 1.0, "end": 2.0, "text": "Hello.", "speaker": "SPEAKER_01"}
+			]}`,
+			language:      "german",
+			speakerLabels: true,
+			wantFields:    map[string]string{"language": "german", "response_format": "verbose_json", "speaker_labels": "true"},
+			want: Transcript{
+				Text:     "Hi. Hello.",
+				Language: "de",
+				Segments: []TranscriptSegment{
+					{Start: 0, End: time.Second, Text: "Hi.", Speaker: "SPEAKER_00"},
+					{Start: time.Second, End: 2 * time.Second, Text: "Hello.", Speaker: "SPEAKER_01"},
+				},
+			},
+		},
+		{
+			name:       "auto-detected language isn't sent",
+			status:     http.StatusOK,
+			reply:      `{"text": "Bonjour.", "language": "french", "duration": 1.0, "segments": [{"start": 0, "end": 1, "text": "Bonjour."}]}`,
+			wantFields: map[string]string{"response_format": "verbose_json"},
+			want: Transcript{
+				Text:     "Bonjour.",
+				Language: "fr",
+				Segments: []TranscriptSegment{{Start: 0, End: time.Second, Text: "Bonjour."}},
+			},
+		},
+		{
+			name:       "empty segments are dropped",
+			status:     http.StatusOK,
+			reply:      `{"text": "Yes.", "segments": [{"start": 0, "end": 1, "text": "  "}, {"start": 1, "end": 2, "text": "Yes."}]}`,
+			language:   "english",
+			wantFields: map[string]string{"language": "english", "response_format": "verbose_json"},
+			want: Transcript{
+				Text:     "Yes.",
+				Segments: []TranscriptSegment{{Start: time.Second, End: 2 * time.Second, Text: "Yes."}},
+			},
+		},
+		{
+			name:       "no segments",
+			status:     http.StatusOK,
+			reply:      `{"text": "Just text.", "language": "klingon", "duration": 3.5}`,
+			language:   "english",
+			wantFields: map[string]string{"language": "english", "response_format": "verbose_json"},
+			want: Transcript{
+				Text:     "Just text.",
+				Segments: []TranscriptSegment{{End: 3500 * time.Millisecond, Text: "Just text."}},
+			},
+		},
+		{
+			name:     "error status",
+			status:   http.StatusUnauthorized,
+			reply:    `{"error": "invalid api key"}`,
+			language: "english",
+			wantErr:  true,
+		},
+		{
+			name:     "malformed reply",
+			status:   http.StatusOK,
+			reply:    `{"text": `,
+			language: "english",
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv, got := newLemonFoxServer(t, tt.status, tt.reply)
+			lf := NewLemonFoxClient(srv.URL+"/v1/", "secret")
+			lf.Language = tt.language
+			lf.SpeakerLabels = tt.speakerLabels
+			lf.HTTPClient = testProviderClient(srv)
+
+			transcript, err := lf.Transcribe(context.Background(), strings.NewReader("RIFF audio"), "3-meeting.wav")
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected an error, got %+v", transcript)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if got.path != "/v1/audio/transcriptions" {
+				t.Errorf("path = %q", got.path)
+			}
+			if got.authorization != "Bearer secret" {
+				t.Errorf("Authorization = %q", got.authorization)
+			}
+			if got.filename != "3-meeting.wav" || got.audio != "RIFF audio" {
+				t.Errorf("file %q = %q", got.filename, got.audio)
+			}
+			if len(got.fields) != len(tt.wantFields) {
+				t.Errorf("fields = %v, want %v", got.fields, tt.wantFields)
+			}
+			for key, value := range tt.wantFields {
+				if got.fields[key] != value {
+					t.Errorf("field %s = %q, want %q", key, got.fields[key], value)
+				}
+			}
+
+			if transcript.Text != tt.want.Text || transcript.Language != tt.want.Language {
+				t.Errorf("transcript = %q (%q), want %q (%q)", transcript.Text, transcript.Language, tt.want.Text, tt.want.Language)
+			}
+			if len(transcript.Segments) != len(tt.want.Segments) {
+				t.Fatalf("segments = %+v, want %+v", transcript.Segments, tt.want.Segments)
+			}
+			for i, s := range transcript.Segments {
+				want := tt.want.Segments[i]
+				if s.Start != want.Start || s.End != want.End || s.Text != want.Text || s.Speaker != want.Speaker {
+					t.Errorf("segment %d = %+v, want %+v", i, s, want)
+				}
+				if diff := s.Confidence - want.Confidence; diff > 1e-9 || diff < -1e-9 {
+					t.Errorf("segment %d confidence = %v, want %v", i, s.Confidence, want.Confidence)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,445 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+	"github.com/cyberhawk12121/Saarthi/internal/events"
+	"github.com/cyberhawk12121/Saarthi/internal/middleware"
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+	"github.com/gin-gonic/gin"
+	"github.com/gorilla/websocket"
+)
+
+// Message types of a live session, see types.LiveMessage.
+const (
+	LiveMessageStart   = "start"
+	LiveMessageStop    = "stop"
+	LiveMessageStarted = "started"
+	LiveMessageError   = "error"
+)
+
+// LiveEncodingPCM is the only audio encoding a live session takes. Opus and
+// the like have to be decoded by the client, which browsers do anyway before
+// handing the audio to an AudioWorklet.
+const LiveEncodingPCM = "pcm"
+
+const (
+	// liveStartTimeout is how long the client has to send the start message.
+	liveStartTimeout = 10 * time.Second
+	// liveReadTimeout ends sessions that send nothing, not even a pong.
+	liveReadTimeout  = time.Minute
+	livePingInterval = 20 * time.Second
+	liveWriteTimeout = 10 * time.Second
+	// maxLiveMessageBytes caps a single message, a few seconds of audio.
+	maxLiveMessageBytes = 1 << 20
+	// liveQueuedWindows is how many windows may wait for the transcriber
+	// before we stop reading the socket.
+	liveQueuedWindows = 4
+	liveFilename      = "live.wav"
+)
+
+// liveUpgrader accepts the socket of a live session from the pages the
+// config allows.
+func (us *UserService) liveUpgrader() *websocket.Upgrader {
+	return &websocket.Upgrader{
+		ReadBufferSize:  16 * 1024,
+		WriteBufferSize: 16 * 1024,
+		CheckOrigin:     us.liveOriginAllowed,
+	}
+}
+
+// liveOriginAllowed lets pages served by the API itself and those of
+// LIVE_ALLOWED_ORIGINS ("*" for any) open live sessions. Clients that aren't
+// browsers send no Origin, their token is what keeps strangers out.
+func (us *UserService) liveOriginAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	for _, allowed := range us.config.LiveAllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	u, err := url.Parse(origin)
+	return err == nil && strings.EqualFold(u.Host, r.Host)
+}
+
+// liveSession is the state of one live session while the audio comes in.
+type liveSession struct {
+	us        *UserService
+	jobId     string
+	recording model.Recording
+	format    audio.PCM
+
+	windowBytes  int
+	overlapBytes int
+	maxBytes     int
+
+	// pending is the audio not transcribed yet, starting with the overlap of
+	// the last window; offset is where it starts in the recording
+	pending  []byte
+	offset   time.Duration
+	received int
+	windows  chan audio.Chunk
+	queued   atomic.Int64
+}
+
+// LiveTranscription runs a live session over a WebSocket: the client streams
+// the audio of a meeting while it happens, gets the transcript back as it
+// grows and the summary once the meeting is over. The session is stored as a
+// recording, like an upload.
+//
+// The client opens with a "start" message (types.LiveStartMessage), sends the
+// audio as binary messages and "stop" at the end. The server answers
+// "started", then sends the events of the recording as messages of their
+// type, and closes the socket after the summary.
+//
+// Browsers can't set headers on a WebSocket, they authenticate with a stream
+// token in the URL (/live?token=...), which the middleware checks before we
+// get here.
+func (us *UserService) LiveTranscription(c *gin.Context) {
+	userId := middleware.UserID(c)
+
+	conn, err := us.liveUpgrader().Upgrade(c.Writer, c.Request, nil)
+	if err != nil {
+		// The upgrader already answered the request
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxLiveMessageBytes)
+
+	//-------------------------------------------------------------------
+	// 1. Read the start message and create the recording and its job
+	//-------------------------------------------------------------------
+	session, err := us.startLiveSession(conn, userId)
+	if err != nil {
+		closeLive(conn, websocket.ClosePolicyViolation, err)
+		return
+	}
+	run := session.us
+	recordingId := session.recording.ID
+
+	// Subscribe before anything is published, the socket gets every event
+	ch, cancel := us.events.Subscribe(recordingId, 0)
+	err = writeLive(conn, types.LiveMessage{
+		Type: LiveMessageStarted,
+		Data: types.LiveStartedEvent{RecordingID: recordingId, JobID: session.jobId},
+	})
+	if err != nil {
+		cancel()
+		run.failJob(session.jobId, recordingId, fmt.Errorf("live session closed before it started: %v", err))
+		return
+	}
+	forwarded := make(chan struct{})
+	go func() {
+		defer close(forwarded)
+		us.forwardLiveEvents(conn, recordingId, ch, cancel)
+	}()
+
+	//-------------------------------------------------------------------
+	// 2. Store the audio and transcribe it window by window as it comes in
+	//-------------------------------------------------------------------
+	ctx, cancelTranscription := context.WithCancel(context.Background())
+	defer cancelTranscription()
+
+	pr, pw := io.Pipe()
+	var uploadErr error
+	uploaded := make(chan struct{})
+	go func() {
+		defer close(uploaded)
+		info, err := run.store.Put(context.Background(), session.recording.StorageKey, pr)
+		if err != nil {
+			uploadErr = err
+			// Unblock the socket reader, it has nowhere to put the audio
+			pr.CloseWithError(err)
+			return
+		}
+		if err := run.recordingRepo.UpdateRecordingUploaded(recordingId, info.ETag); err != nil {
+			log.Printf("job %s: error marking recording %d as uploaded: %v", session.jobId, recordingId, err)
+		}
+	}()
+
+	var transcript Transcript
+	var transcriptionErr error
+	transcribed := make(chan struct{})
+	go func() {
+		defer close(transcribed)
+		transcript, transcriptionErr = session.transcribe(ctx)
+		if transcriptionErr != nil {
+			// Stop taking audio we can't transcribe
+			cancelTranscription()
+		}
+	}()
+
+	//-------------------------------------------------------------------
+	// 3. Read the audio until the client stops, goes away or runs too long
+	//-------------------------------------------------------------------
+	_, err = pw.Write(session.format.StreamHeader())
+	for err == nil && ctx.Err() == nil && session.received < session.maxBytes {
+		conn.SetReadDeadline(time.Now().Add(liveReadTimeout))
+		kind, data, readErr := conn.ReadMessage()
+		if readErr != nil {
+			// The client went away, what we have is the recording
+			break
+		}
+		if kind == websocket.TextMessage {
+			var msg types.LiveMessage
+			if json.Unmarshal(data, &msg) == nil && msg.Type == LiveMessageStop {
+				break
+			}
+			continue
+		}
+		if _, err = pw.Write(data); err == nil {
+			session.add(data)
+		}
+	}
+	session.flush()
+	close(session.windows)
+	pw.Close()
+
+	// Keep handling pings and the close handshake while the summary is written
+	conn.SetReadDeadline(time.Time{})
+	go func() {
+		for {
+			if _, _, err := conn.NextReader(); err != nil {
+				return
+			}
+		}
+	}()
+
+	<-transcribed
+	<-uploaded
+
+	//-------------------------------------------------------------------
+	// 4. Summarize the session like an upload
+	//-------------------------------------------------------------------
+	switch {
+	case uploadErr != nil:
+		run.failJob(session.jobId, recordingId, fmt.Errorf("upload to storage failed: %v", uploadErr))
+	case transcriptionErr != nil:
+		run.failJob(session.jobId, recordingId, fmt.Errorf("transcription failed: %v", transcriptionErr))
+	case session.received == 0:
+		run.failJob(session.jobId, recordingId, errors.New("no audio received"))
+	default:
+		run.finishJob(context.Background(), session.jobId, recordingId, userId, transcript)
+	}
+	<-forwarded
+}
+
+// startLiveSession reads the start message and creates the recording and the
+// job of the session.
+func (us *UserService) startLiveSession(conn *websocket.Conn, userId string) (*liveSession, error) {
+	var start types.LiveStartMessage
+	conn.SetReadDeadline(time.Now().Add(liveStartTimeout))
+	if err := conn.ReadJSON(&start); err != nil || start.Type != LiveMessageStart {
+		return nil, errors.New("expected a start message")
+	}
+
+	if start.Encoding != "" && start.Encoding != LiveEncodingPCM {
+		return nil, fmt.Errorf("unsupported encoding %q, send raw PCM", start.Encoding)
+	}
+	format := audio.PCM{SampleRate: start.SampleRate, Channels: start.Channels, BitsPerSample: start.BitsPerSample}
+	if format.SampleRate == 0 {
+		format.SampleRate = 16000
+	}
+	if format.Channels == 0 {
+		format.Channels = 1
+	}
+	if format.BitsPerSample == 0 {
+		format.BitsPerSample = 16
+	}
+	if err := format.Validate(); err != nil {
+		return nil, err
+	}
+
+	language, err := us.recordingLanguage(userId, start.Language)
+	if err != nil {
+		return nil, err
+	}
+	run, err := us.withOverrides(types.ReprocessRequest{Language: language})
+	if err != nil {
+		return nil, err
+	}
+
+	recording, err := us.recordingRepo.CreateRecording(userId, language)
+	if err != nil {
+		return nil, errors.New("unable to create recording")
+	}
+	jobId, err := us.jobRepo.CreateJob(recording.ID, userId)
+	if err != nil {
+		return nil, errors.New("unable to create job")
+	}
+
+	window := us.config.LiveWindow
+	return &liveSession{
+		us:           run,
+		jobId:        jobId,
+		recording:    recording,
+		format:       format,
+		windowBytes:  format.Bytes(window),
+		overlapBytes: format.Bytes(audio.DefaultOptions().Overlap),
+		maxBytes:     format.Bytes(us.config.LiveMaxDuration),
+		windows:      make(chan audio.Chunk, liveQueuedWindows),
+	}, nil
+}
+
+// add takes the next piece of audio and queues every window that is full.
+// Neighbouring windows share the overlap, so words at the cut survive.
+func (ls *liveSession) add(data []byte) {
+	ls.received += len(data)
+	ls.pending = append(ls.pending, data...)
+	for len(ls.pending) >= ls.windowBytes {
+		ls.queue(ls.pending[:ls.windowBytes])
+		step := ls.windowBytes - ls.overlapBytes
+		ls.offset += ls.format.Duration(step)
+		ls.pending = append([]byte(nil), ls.pending[step:]...)
+	}
+}
+
+// flush queues the audio left after the last full window.
+func (ls *liveSession) flush() {
+	// Whole frames only, and not the overlap alone, the last window has it
+	pcm := ls.pending[:len(ls.pending)-len(ls.pending)%ls.format.FrameSize()]
+	if len(pcm) > ls.overlapBytes || (ls.queued.Load() == 0 && len(pcm) > 0) {
+		ls.queue(pcm)
+	}
+	ls.pending = nil
+}
+
+func (ls *liveSession) queue(pcm []byte) {
+	ls.windows <- audio.Chunk{
+		Index:    int(ls.queued.Add(1)) - 1,
+		Format:   audio.FormatWAV,
+		Data:     ls.format.WAV(pcm),
+		Offset:   ls.offset,
+		Duration: ls.format.Duration(len(pcm)),
+	}
+}
+
+// transcribe transcribes the windows in order as they are queued, stitches
+// them together and publishes what every window added. It drains the queue
+// even after a failure, so the socket reader never blocks on it.
+func (ls *liveSession) transcribe(ctx context.Context) (Transcript, error) {
+	us := ls.us
+	progress := us.jobProgress(ls.jobId, ls.recording.ID)
+	progress(0, 0)
+
+	var st stitcher
+	var parts []Transcript
+	var chunks []audio.Chunk
+	var firstErr error
+	for chunk := range ls.windows {
+		if firstErr != nil {
+			continue
+		}
+		part, err := us.transcribeChunk(ctx, chunk, liveFilename)
+		if err != nil {
+			firstErr = err
+			continue
+		}
+		added := st.add(part, chunk)
+
+		// Speakers are numbered over everything so far; a new one only ever
+		// gets the next number, so earlier events stay right
+		numbered := append([]TranscriptSegment(nil), st.transcript.Segments...)
+		numberSpeakers(numbered)
+		us.events.Publish(ls.recording.ID, EventTranscript, liveTranscriptEvent(ls.jobId, chunk, numbered[len(numbered)-added:]))
+
+		chunk.Data = nil
+		parts = append(parts, part)
+		chunks = append(chunks, chunk)
+		progress(len(chunks), int(ls.queued.Load()))
+	}
+	if firstErr != nil {
+		return Transcript{}, firstErr
+	}
+
+	transcript := st.transcript
+	numberSpeakers(transcript.Segments)
+	transcript.Language = us.transcriptLanguage(parts, chunks)
+	return transcript, nil
+}
+
+// liveTranscriptEvent is what a window added to the transcript of a live session.
+func liveTranscriptEvent(jobId string, chunk audio.Chunk, segments []TranscriptSegment) types.TranscriptEvent {
+	event := types.TranscriptEvent{
+		JobID:    jobId,
+		Chunk:    chunk.Index,
+		Start:    chunk.Offset.Seconds(),
+		End:      (chunk.Offset + chunk.Duration).Seconds(),
+		Segments: make([]types.TranscriptSegment, 0, len(segments)),
+	}
+	for i, s := range segments {
+		if i > 0 {
+			event.Text += " "
+		}
+		event.Text += s.Text
+		segment := types.TranscriptSegment{Start: s.Start.Seconds(), End: s.End.Seconds(), Text: s.Text, Speaker: s.Speaker}
+		if s.Confidence > 0 {
+			confidence := s.Confidence
+			segment.Confidence = &confidence
+		}
+		event.Segments = append(event.Segments, segment)
+	}
+	return event
+}
+
+// forwardLiveEvents sends the events of the recording over the socket until
+// the job is done or failed, then closes it. It is the only writer once the
+// session has started.
+func (us *UserService) forwardLiveEvents(conn *websocket.Conn, recordingId int, ch <-chan events.Event, cancel func()) {
+	defer func() { cancel() }()
+
+	ping := time.NewTicker(livePingInterval)
+	defer ping.Stop()
+
+	var lastId int64
+	for {
+		select {
+		case event, ok := <-ch:
+			if !ok {
+				// We fell behind, pick up where we were
+				ch, cancel = us.events.Subscribe(recordingId, lastId)
+				continue
+			}
+			lastId = event.ID
+			if err := writeLive(conn, types.LiveMessage{Type: event.Type, Data: event.Data}); err != nil {
+				return
+			}
+			if stage, ok := event.Data.(types.StageEvent); ok && (stage.Stage == model.JobStageDone || stage.Stage == model.JobStageFailed) {
+				closeLive(conn, websocket.CloseNormalClosure, nil)
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteControl(websocket.PingMessage, nil, time.Now().Add(liveWriteTimeout)); err != nil {
+				return
+			}
+		}
+	}
+}
+
+func writeLive(conn *websocket.Conn, msg types.LiveMessage) error {
+	conn.SetWriteDeadline(time.Now().Add(liveWriteTimeout))
+	return conn.WriteJSON(msg)
+}
+
+// closeLive sends err, if any, and closes the session with code.
+func closeLive(conn *websocket.Conn, code int, err error) {
+	if err != nil {
+		writeLive(conn, types.LiveMessage{Type: LiveMessageError, Data: gin.H{"error": err.Error()}})
+	}
+	conn.WriteControl(websocket.CloseMessage, websocket.FormatCloseMessage(code, ""), time.Now().Add(liveWriteTimeout))
+}
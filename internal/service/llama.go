@@ -1,84 +1,115 @@
 package service
 
 import (
-	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"io"
-	"net/http"
+	"strings"
 
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
 	types "github.com/cyberhawk12121/Saarthi/internal/shared"
 )
 
-// callLlamaAPI uses the transcribed text as input to the Llama API.
-func (us *UserService) callLlamaAPI(transcribedText string) ([]byte, int, error) {
-	// Build the request payload
-	payload := types.LlamaRequest{
-		Messages: []map[string]string{
-			{
-				"role":    "user",
-				"content": transcribedText,
-			},
-		},
-		Functions: []map[string]interface{}{
-			{
-				"name":        "get_current_weather",
-				"description": "Get the current weather in a given location",
-				"parameters": map[string]interface{}{
-					"type": "object",
-					"properties": map[string]interface{}{
-						"location": map[string]interface{}{
-							"type":        "string",
-							"description": "The city and state, e.g. San Francisco, CA",
-						},
-						"days": map[string]interface{}{
-							"type":        "number",
-							"description": "for how many days ahead you want the forecast",
-						},
-						"unit": map[string]interface{}{
-							"type": "string",
-							"enum": []string{"celsius", "fahrenheit"},
-						},
-					},
-					"required": []string{"location", "days"},
-				},
-			},
-		},
-		Stream:       false,
-		FunctionCall: "get_current_weather",
-	}
+const defaultLlamaBaseURL = "https://api.llama-api.com"
 
-	reqBodyBytes, err := json.Marshal(payload)
-	if err != nil {
-		return nil, 0, fmt.Errorf("error marshaling llama request: %v", err)
+// LlamaResponse models the JSON response of the Llama API
+type LlamaResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Role         string `json:"role"`
+			Content      string `json:"content"`
+			FunctionCall *struct {
+				Name      string          `json:"name"`
+				Arguments json.RawMessage `json:"arguments"`
+			} `json:"function_call"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// LlamaSummarizer talks to api.llama-api.com, which takes OpenAI-style
+// "functions" and a forced "function_call".
+type LlamaSummarizer struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *httpclient.Client
+}
+
+func NewLlamaSummarizer(baseURL, apiKey, model string) *LlamaSummarizer {
+	if baseURL == "" {
+		baseURL = defaultLlamaBaseURL
 	}
+	return &LlamaSummarizer{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: providerClient("Llama API", httpclient.DefaultOptions()),
+	}
+}
 
-	req, err := http.NewRequest(
-		"POST",
-		"https://api.llama-api.com/chat/completions",
-		bytes.NewBuffer(reqBodyBytes),
-	)
-	if err != nil {
-		return nil, 0, fmt.Errorf("error creating llama request: %v", err)
+func (ls *LlamaSummarizer) Summarize(ctx context.Context, sr SummaryRequest) (*SummaryResponse, error) {
+	payload := ls.request(sr, false)
+
+	var llamaResp LlamaResponse
+	if err := postJSON(ctx, ls.HTTPClient, "Llama API", ls.BaseURL+"/chat/completions", ls.APIKey, payload, &llamaResp); err != nil {
+		return nil, err
+	}
+	if len(llamaResp.Choices) == 0 {
+		return nil, errors.New("llama API returned no choices")
 	}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Bearer "+us.config.LlamaAPIKey)
+	choice := llamaResp.Choices[0]
+	resp := &SummaryResponse{
+		Provider:     SummarizerProviderLlama,
+		Model:        llamaResp.Model,
+		Content:      choice.Message.Content,
+		FinishReason: choice.FinishReason,
+	}
+	if choice.Message.FunctionCall != nil {
+		resp.Arguments = functionArguments(choice.Message.FunctionCall.Arguments)
+	}
+	return resp, nil
+}
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+// SummarizeStream is Summarize with the reply streamed to onDelta as it is written.
+func (ls *LlamaSummarizer) SummarizeStream(ctx context.Context, sr SummaryRequest, onDelta func(string)) (*SummaryResponse, error) {
+	body, err := postJSONStream(ctx, ls.HTTPClient, "Llama API", ls.BaseURL+"/chat/completions", ls.APIKey, ls.request(sr, true))
 	if err != nil {
-		return nil, 0, fmt.Errorf("error sending request to Llama API: %v", err)
+		return nil, err
 	}
-	defer resp.Body.Close()
+	defer body.Close()
 
-	respBody, err := io.ReadAll(resp.Body)
+	resp, err := readChatStream(body, SummarizerProviderLlama, onDelta)
 	if err != nil {
-		return nil, 0, fmt.Errorf("error reading Llama API response: %v", err)
+		return nil, fmt.Errorf("llama API: %v", err)
 	}
+	return resp, nil
+}
 
-	// Debug: check the response
-	fmt.Printf("Llama API response: %s\n", respBody)
-
-	return respBody, resp.StatusCode, nil
+// request builds the request payload
+func (ls *LlamaSummarizer) request(sr SummaryRequest, stream bool) types.LlamaRequest {
+	payload := types.LlamaRequest{
+		Model:  ls.Model,
+		Stream: stream,
+	}
+	for _, m := range sr.Messages {
+		payload.Messages = append(payload.Messages, map[string]string{
+			"role":    m.Role,
+			"content": m.Content,
+		})
+	}
+	if sr.Function != nil {
+		payload.Functions = []map[string]interface{}{
+			{
+				"name":        sr.Function.Name,
+				"description": sr.Function.Description,
+				"parameters":  sr.Function.Parameters,
+			},
+		}
+		payload.FunctionCall = sr.Function.Name
+	}
+	return payload
 }
@@ -0,0 +1,286 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+const (
+	// summaryReplyTokens is what we keep free in the budget for the model's reply.
+	summaryReplyTokens = 1500
+	// sectionHeaderTokens leaves room for the "Part i of n, from ... to ..." line.
+	sectionHeaderTokens = 20
+)
+
+const sectionPrompt = `You are an assistant that writes meeting notes.
+You will be given one part of the transcript of a longer meeting, along with where it is in the recording. Summarize only this part by calling the record_meeting_summary function.
+` + summaryRules
+
+const reducePrompt = `You are an assistant that writes meeting notes.
+You will be given the summaries of consecutive parts of one meeting, in order, each with where it is in the recording. Merge them into one summary of the whole meeting by calling the record_meeting_summary function.
+- The title and tldr describe the whole meeting, not its first part.
+- Merge points, decisions and action items that repeat across parts instead of listing them twice.
+- Keep the owners, due dates and timestamps of action items exactly as they are.
+- A question that is answered in a later part is not an open question.
+` + summaryRules
+
+// transcriptSection is a piece of the transcript small enough for one request.
+type transcriptSection struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+}
+
+// partialSummary is the summary of one or more consecutive sections.
+type partialSummary struct {
+	Start   time.Duration
+	End     time.Duration
+	Summary *types.MeetingSummary
+}
+
+// tokenBudget returns the token budget of the configured summarizer model.
+func (us *UserService) tokenBudget() int {
+	if budget, ok := us.config.SummarizerTokenBudgets[us.config.SummarizerModel]; ok {
+		return budget
+	}
+	return us.config.SummarizerTokenBudget
+}
+
+// estimateTokens guesses how many tokens s is without the model's tokenizer.
+// Three bytes per token overestimates English a little, which keeps us on the
+// safe side, and still holds up for scripts that take more bytes per character.
+func estimateTokens(s string) int {
+	return (len(s) + 2) / 3
+}
+
+// summarizeLong summarizes a transcript that doesn't fit the budget in map and
+// reduce steps: every section of the transcript is summarized on its own, then
+// the section summaries are merged into one. The section summaries are kept in
+// the result with their place in the recording. Only the final merge is
+// streamed to onDelta.
+func (us *UserService) summarizeLong(ctx context.Context, transcript Transcript, budget int, onDelta func(string)) (*types.MeetingSummary, error) {
+	//-------------------------------------------------------------------
+	// 1. Map: summarize every section of the transcript
+	//-------------------------------------------------------------------
+	mapPrompt := sectionPrompt + languageRule(transcript.Language)
+	sectionBudget := budget - estimateTokens(mapPrompt) - summaryReplyTokens - sectionHeaderTokens
+	if sectionBudget <= 0 {
+		return nil, fmt.Errorf("token budget of %d is too small to summarize anything", budget)
+	}
+	sections := splitTranscript(transcript, sectionBudget)
+
+	partials := make([]partialSummary, 0, len(sections))
+	for i, section := range sections {
+		content := fmt.Sprintf("Part %d of %d, from %s to %s:\n\n%s",
+			i+1, len(sections), formatTimestamp(section.Start), formatTimestamp(section.End), section.Text)
+		summary, err := us.requestSummary(ctx, mapPrompt, content, nil)
+		if err != nil {
+			return nil, fmt.Errorf("error summarizing part %d of %d: %v", i+1, len(sections), err)
+		}
+		partials = append(partials, partialSummary{Start: section.Start, End: section.End, Summary: summary})
+	}
+
+	//-------------------------------------------------------------------
+	// 2. Reduce: merge the section summaries into one
+	//-------------------------------------------------------------------
+	summary, err := us.reduceSummaries(ctx, partials, budget, reducePrompt+languageRule(transcript.Language), onDelta)
+	if err != nil {
+		return nil, err
+	}
+
+	summary.Sections = make([]types.SummarySection, 0, len(partials))
+	for _, p := range partials {
+		summary.Sections = append(summary.Sections, types.SummarySection{
+			Start: p.Start.Seconds(),
+			End:   p.End.Seconds(),
+			Title: p.Summary.Title,
+			TLDR:  p.Summary.TLDR,
+		})
+	}
+	return summary, nil
+}
+
+// reduceSummaries merges the partial summaries into one with prompt. When
+// they don't fit the budget together, neighbours are merged in groups first,
+// and again, until they do. The last merge is streamed to onDelta.
+func (us *UserService) reduceSummaries(ctx context.Context, partials []partialSummary, budget int, prompt string, onDelta func(string)) (*types.MeetingSummary, error) {
+	available := budget - estimateTokens(prompt) - summaryReplyTokens
+
+	for {
+		if len(partials) == 1 {
+			return partials[0].Summary, nil
+		}
+
+		content, err := formatPartials(partials)
+		if err != nil {
+			return nil, err
+		}
+		if estimateTokens(content) <= available {
+			return us.requestSummary(ctx, prompt, content, onDelta)
+		}
+
+		var merged []partialSummary
+		for _, group := range groupPartials(partials, available) {
+			if len(group) == 1 {
+				merged = append(merged, group[0])
+				continue
+			}
+			content, err := formatPartials(group)
+			if err != nil {
+				return nil, err
+			}
+			summary, err := us.requestSummary(ctx, prompt, content, nil)
+			if err != nil {
+				return nil, fmt.Errorf("error merging summaries from %s to %s: %v",
+					formatTimestamp(group[0].Start), formatTimestamp(group[len(group)-1].End), err)
+			}
+			merged = append(merged, partialSummary{Start: group[0].Start, End: group[len(group)-1].End, Summary: summary})
+		}
+		partials = merged
+	}
+}
+
+// groupPartials splits partials into runs of neighbours that fit available
+// tokens together. Every group but a trailing one has at least two partials,
+// so each round of merging makes progress.
+func groupPartials(partials []partialSummary, available int) [][]partialSummary {
+	var groups [][]partialSummary
+	start, tokens := 0, 0
+	for i, p := range partials {
+		t := partialTokens(p)
+		if i-start >= 2 && tokens+t > available {
+			groups = append(groups, partials[start:i])
+			start, tokens = i, 0
+		}
+		tokens += t
+	}
+	return append(groups, partials[start:])
+}
+
+func partialTokens(p partialSummary) int {
+	content, err := formatPartials([]partialSummary{p})
+	if err != nil {
+		return 0
+	}
+	return estimateTokens(content)
+}
+
+// formatPartials writes the summaries as JSON, each under the time range it covers.
+func formatPartials(partials []partialSummary) (string, error) {
+	var b strings.Builder
+	for i, p := range partials {
+		summary, err := json.Marshal(p.Summary)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprintf(&b, "Part %d, from %s to %s:\n%s\n\n", i+1, formatTimestamp(p.Start), formatTimestamp(p.End), summary)
+	}
+	return b.String(), nil
+}
+
+// splitTranscript cuts the transcript into sections of at most maxTokens along
+// segment boundaries. A segment that is too long on its own is cut between
+// words, with its time range shared out by the length of each piece.
+func splitTranscript(transcript Transcript, maxTokens int) []transcriptSection {
+	segments := transcript.Segments
+	if len(segments) == 0 {
+		segments = []TranscriptSegment{{Text: transcript.Text}}
+	}
+
+	var sections []transcriptSection
+	var current transcriptSection
+	flush := func() {
+		if current.Text != "" {
+			sections = append(sections, current)
+		}
+		current = transcriptSection{}
+	}
+
+	for _, segment := range segments {
+		for _, piece := range splitSegment(segment, maxTokens) {
+			if current.Text != "" && estimateTokens(current.Text)+1+estimateTokens(piece.Text) > maxTokens {
+				flush()
+			}
+			if current.Text == "" {
+				current.Start = piece.Start
+				current.Text = piece.Text
+			} else {
+				current.Text += " " + piece.Text
+			}
+			current.End = piece.End
+		}
+	}
+	flush()
+
+	return sections
+}
+
+// splitSegment cuts a segment into pieces of at most maxTokens between words.
+func splitSegment(segment TranscriptSegment, maxTokens int) []TranscriptSegment {
+	if estimateTokens(segment.Text) <= maxTokens {
+		return []TranscriptSegment{segment}
+	}
+
+	words := strings.Fields(segment.Text)
+	total := 0
+	for _, word := range words {
+		total += len(word) + 1
+	}
+	length := segment.End - segment.Start
+
+	var pieces []TranscriptSegment
+	var piece []string
+	pieceBytes, doneBytes := 0, 0
+	emit := func() {
+		if len(piece) == 0 {
+			return
+		}
+		start := segment.Start + length*time.Duration(doneBytes)/time.Duration(total)
+		doneBytes += pieceBytes
+		end := segment.Start + length*time.Duration(doneBytes)/time.Duration(total)
+		pieces = append(pieces, TranscriptSegment{Start: start, End: end, Text: strings.Join(piece, " ")})
+		piece, pieceBytes = nil, 0
+	}
+
+	for _, word := range words {
+		// pieceBytes counts a space after every word, like the joined text
+		if len(piece) > 0 && (pieceBytes+len(word)+2)/3 > maxTokens {
+			emit()
+		}
+		piece = append(piece, word)
+		pieceBytes += len(word) + 1
+	}
+	emit()
+
+	return pieces
+}
+
+// parseTimestamp reads a time in the recording written as HH:MM:SS or MM:SS.
+func parseTimestamp(s string) (time.Duration, bool) {
+	parts := strings.Split(s, ":")
+	if len(parts) < 2 || len(parts) > 3 {
+		return 0, false
+	}
+	var d time.Duration
+	for i, part := range parts {
+		n, err := strconv.Atoi(part)
+		// Every part but the hours is below 60
+		if err != nil || n < 0 || (i > 0 && n >= 60) {
+			return 0, false
+		}
+		d = d*60 + time.Duration(n)
+	}
+	return d * time.Second, true
+}
+
+// formatTimestamp writes d as HH:MM:SS.
+func formatTimestamp(d time.Duration) string {
+	d = d.Round(time.Second)
+	return fmt.Sprintf("%02d:%02d:%02d", int(d.Hours()), int(d.Minutes())%60, int(d.Seconds())%60)
+}
@@ -0,0 +1,229 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+const summaryPrompt = `You are an assistant that writes meeting notes.
+You will be given the transcript of a meeting. Summarize it by calling the record_meeting_summary function.
+` + summaryRules
+
+// summaryRules are shared by every prompt that asks for a meeting summary.
+const summaryRules = `- Only use facts from the transcript, never invent owners, dates or decisions.
+- Key points, decisions and open questions are short, standalone sentences.
+- An action item has an owner only if the transcript says who will do it.
+- Lines start with their time in the recording, like [00:12:30], and may go on with the name of the speaker, like "Speaker 1:". Use that name exactly as written when crediting a point, decision or action item to someone.
+- Give every action item the time of the line where it was agreed, as HH:MM:SS.
+- Due dates are written as YYYY-MM-DD, and left empty if the transcript gives none.
+- Leave a list empty rather than padding it.`
+
+// summaryFunction describes types.MeetingSummary as a JSON schema.
+var summaryFunction = SummaryFunction{
+	Name:        "record_meeting_summary",
+	Description: "Record the structured summary of a meeting",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"title": map[string]interface{}{
+				"type":        "string",
+				"description": "A short title for the meeting",
+			},
+			"tldr": map[string]interface{}{
+				"type":        "string",
+				"description": "Two or three sentences on what the meeting was about and its outcome",
+			},
+			"key_points": stringList("The main points that were discussed"),
+			"decisions":  stringList("Decisions that were made"),
+			"action_items": map[string]interface{}{
+				"type":        "array",
+				"description": "Tasks someone agreed to do",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"description": map[string]interface{}{
+							"type":        "string",
+							"description": "What has to be done",
+						},
+						"owner": map[string]interface{}{
+							"type":        "string",
+							"description": "Who will do it, empty if nobody was named",
+						},
+						"due_date": map[string]interface{}{
+							"type":        "string",
+							"description": "When it is due as YYYY-MM-DD, empty if no date was given",
+						},
+						"timestamp": map[string]interface{}{
+							"type":        "string",
+							"description": "Where in the recording it was agreed as HH:MM:SS, from the line it came up in",
+						},
+					},
+					"required": []string{"description"},
+				},
+			},
+			"open_questions": stringList("Questions that were raised but not answered"),
+		},
+		"required": []string{"title", "tldr", "key_points", "decisions", "action_items", "open_questions"},
+	},
+}
+
+func stringList(description string) map[string]interface{} {
+	return map[string]interface{}{
+		"type":        "array",
+		"description": description,
+		"items":       map[string]interface{}{"type": "string"},
+	}
+}
+
+// summarize asks the configured Summarizer for a meeting summary of the
+// transcript and returns it parsed and validated. Transcripts that don't fit
+// the model's token budget are summarized with summarizeLong. onDelta, if not
+// nil, gets the final summary as the LLM writes it, when the backend streams.
+func (us *UserService) summarize(ctx context.Context, transcript Transcript, onDelta func(string)) (*types.MeetingSummary, error) {
+	transcript = transcript.forSummary()
+	budget := us.tokenBudget()
+	prompt := summaryPrompt + languageRule(transcript.Language)
+	if estimateTokens(prompt)+estimateTokens(transcript.Text)+summaryReplyTokens > budget {
+		return us.summarizeLong(ctx, transcript, budget, onDelta)
+	}
+	return us.requestSummary(ctx, prompt, transcript.Text, onDelta)
+}
+
+// languageRule tells the model to write the summary in the language of the
+// meeting, which it would otherwise pick from the (English) prompt.
+func languageRule(language string) string {
+	if language == "" {
+		return ""
+	}
+	return fmt.Sprintf("\n- Write the summary in %s, the language of the meeting, even though these instructions are in English.", languageName(language))
+}
+
+// requestSummary sends one summary request with the given system prompt and
+// returns the parsed and validated reply. With onDelta the reply is streamed
+// to it, if the backend can stream.
+func (us *UserService) requestSummary(ctx context.Context, prompt string, content string, onDelta func(string)) (*types.MeetingSummary, error) {
+	req := SummaryRequest{
+		Messages: []ChatMessage{
+			{Role: "system", Content: prompt},
+			{Role: "user", Content: content},
+		},
+		Function: &summaryFunction,
+	}
+
+	var resp *SummaryResponse
+	var err error
+	if streaming, ok := us.summarizer.(StreamingSummarizer); ok && onDelta != nil {
+		resp, err = streaming.SummarizeStream(ctx, req, onDelta)
+	} else {
+		resp, err = us.summarizer.Summarize(ctx, req)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	summary, err := parseMeetingSummary(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid summary from %s (%s): %v", resp.Provider, resp.Model, err)
+	}
+	return summary, nil
+}
+
+// parseMeetingSummary reads the summary from the reply and validates it.
+func parseMeetingSummary(resp *SummaryResponse) (*types.MeetingSummary, error) {
+	raw, err := replyJSON(resp)
+	if err != nil {
+		return nil, err
+	}
+
+	var summary types.MeetingSummary
+	if err := json.Unmarshal(raw, &summary); err != nil {
+		return nil, fmt.Errorf("error parsing summary JSON: %v", err)
+	}
+	if err := validateMeetingSummary(&summary); err != nil {
+		return nil, err
+	}
+	return &summary, nil
+}
+
+// replyJSON returns the function call arguments of the reply, or the
+// message content for models that answered in plain JSON instead of calling
+// the function.
+func replyJSON(resp *SummaryResponse) ([]byte, error) {
+	raw := []byte(resp.Arguments)
+	if len(raw) == 0 {
+		raw = []byte(stripCodeFence(resp.Content))
+	}
+	if len(raw) == 0 {
+		return nil, errors.New("empty reply")
+	}
+	return raw, nil
+}
+
+// validateMeetingSummary checks the required fields and normalizes the rest,
+// so clients always get lists (never null) and either a valid date or none.
+func validateMeetingSummary(summary *types.MeetingSummary) error {
+	summary.Title = strings.TrimSpace(summary.Title)
+	summary.TLDR = strings.TrimSpace(summary.TLDR)
+	if summary.Title == "" {
+		return errors.New("summary has no title")
+	}
+	if summary.TLDR == "" {
+		return errors.New("summary has no tldr")
+	}
+
+	summary.KeyPoints = cleanList(summary.KeyPoints)
+	summary.Decisions = cleanList(summary.Decisions)
+	summary.OpenQuestions = cleanList(summary.OpenQuestions)
+
+	actionItems := make([]types.ActionItem, 0, len(summary.ActionItems))
+	for _, item := range summary.ActionItems {
+		item.Description = strings.TrimSpace(item.Description)
+		item.Owner = strings.TrimSpace(item.Owner)
+		item.DueDate = strings.TrimSpace(item.DueDate)
+		item.Timestamp = strings.Trim(item.Timestamp, " []")
+		if item.Description == "" {
+			continue
+		}
+		// Models sometimes write "next week" or "N/A"; drop what isn't a date
+		if _, err := time.Parse(time.DateOnly, item.DueDate); err != nil {
+			item.DueDate = ""
+		}
+		if _, ok := parseTimestamp(item.Timestamp); !ok {
+			item.Timestamp = ""
+		}
+		actionItems = append(actionItems, item)
+	}
+	summary.ActionItems = actionItems
+	// Resources are looked up by us afterwards, never made up by the model
+	summary.Resources = nil
+
+	return nil
+}
+
+func cleanList(items []string) []string {
+	cleaned := make([]string, 0, len(items))
+	for _, item := range items {
+		if item = strings.TrimSpace(item); item != "" {
+			cleaned = append(cleaned, item)
+		}
+	}
+	return cleaned
+}
+
+// stripCodeFence removes the ```json fences models like to wrap JSON in.
+func stripCodeFence(s string) string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, "```") {
+		return s
+	}
+	s = strings.TrimPrefix(s, "```")
+	s = strings.TrimPrefix(s, "json")
+	s = strings.TrimSuffix(s, "```")
+	return strings.TrimSpace(s)
+}
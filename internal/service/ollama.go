@@ -0,0 +1,133 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+const (
+	defaultOllamaBaseURL = "http://localhost:11434"
+	defaultOllamaModel   = "llama3.1"
+)
+
+type ollamaChatRequest struct {
+	Model    string        `json:"model"`
+	Messages []ChatMessage `json:"messages"`
+	Stream   bool          `json:"stream"`
+	// Format takes a JSON schema and constrains the reply to it
+	Format interface{} `json:"format,omitempty"`
+}
+
+// OllamaChatResponse models the JSON response of Ollama's /api/chat
+type OllamaChatResponse struct {
+	Model   string `json:"model"`
+	Message struct {
+		Role    string `json:"role"`
+		Content string `json:"content"`
+	} `json:"message"`
+	Done       bool   `json:"done"`
+	DoneReason string `json:"done_reason"`
+	// Error is how Ollama reports a failure in the middle of a stream
+	Error string `json:"error"`
+}
+
+// OllamaSummarizer talks to a local Ollama server. Ollama has no function
+// calling for structured output, so the function's schema is passed as the
+// response format and the reply content is the arguments.
+type OllamaSummarizer struct {
+	BaseURL    string
+	Model      string
+	HTTPClient *httpclient.Client
+}
+
+func NewOllamaSummarizer(baseURL, model string) *OllamaSummarizer {
+	if baseURL == "" {
+		baseURL = defaultOllamaBaseURL
+	}
+	if model == "" {
+		model = defaultOllamaModel
+	}
+	return &OllamaSummarizer{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		Model:      model,
+		HTTPClient: providerClient("Ollama", httpclient.DefaultOptions()),
+	}
+}
+
+func (ol *OllamaSummarizer) Summarize(ctx context.Context, sr SummaryRequest) (*SummaryResponse, error) {
+	var chatResp OllamaChatResponse
+	if err := postJSON(ctx, ol.HTTPClient, "Ollama", ol.BaseURL+"/api/chat", "", ol.request(sr, false), &chatResp); err != nil {
+		return nil, err
+	}
+	return ol.response(sr, chatResp.Model, chatResp.Message.Content, chatResp.DoneReason), nil
+}
+
+// SummarizeStream is Summarize with the reply streamed to onDelta as it is
+// written. Ollama streams one JSON object per line.
+func (ol *OllamaSummarizer) SummarizeStream(ctx context.Context, sr SummaryRequest, onDelta func(string)) (*SummaryResponse, error) {
+	body, err := postJSONStream(ctx, ol.HTTPClient, "Ollama", ol.BaseURL+"/api/chat", "", ol.request(sr, true))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	var model, doneReason string
+	var content strings.Builder
+	done := false
+	dec := json.NewDecoder(body)
+	for !done {
+		var chunk OllamaChatResponse
+		if err := dec.Decode(&chunk); err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, fmt.Errorf("error reading Ollama stream: %v", err)
+		}
+		if chunk.Error != "" {
+			return nil, fmt.Errorf("ollama: %s", chunk.Error)
+		}
+
+		model = chunk.Model
+		if chunk.Message.Content != "" {
+			content.WriteString(chunk.Message.Content)
+			onDelta(chunk.Message.Content)
+		}
+		done = chunk.Done
+		doneReason = chunk.DoneReason
+	}
+	// The last object says done, without it the stream was cut off
+	if !done {
+		return nil, errors.New("ollama stream ended before the reply was complete")
+	}
+	return ol.response(sr, model, content.String(), doneReason), nil
+}
+
+func (ol *OllamaSummarizer) request(sr SummaryRequest, stream bool) ollamaChatRequest {
+	payload := ollamaChatRequest{
+		Model:    ol.Model,
+		Messages: sr.Messages,
+		Stream:   stream,
+	}
+	if sr.Function != nil {
+		payload.Format = sr.Function.Parameters
+	}
+	return payload
+}
+
+func (ol *OllamaSummarizer) response(sr SummaryRequest, model, content, doneReason string) *SummaryResponse {
+	resp := &SummaryResponse{
+		Provider:     SummarizerProviderOllama,
+		Model:        model,
+		Content:      content,
+		FinishReason: doneReason,
+	}
+	if sr.Function != nil && json.Valid([]byte(content)) {
+		resp.Arguments = json.RawMessage(content)
+	}
+	return resp
+}
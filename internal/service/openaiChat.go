@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+const (
+	defaultOpenAIBaseURL   = "https://api.openai.com/v1"
+	defaultOpenAIChatModel = "gpt-4o-mini"
+)
+
+type openAITool struct {
+	Type     string             `json:"type"`
+	Function openAIToolFunction `json:"function"`
+}
+
+type openAIToolFunction struct {
+	Name        string                 `json:"name"`
+	Description string                 `json:"description,omitempty"`
+	Parameters  map[string]interface{} `json:"parameters,omitempty"`
+}
+
+type openAIChatRequest struct {
+	Model      string        `json:"model"`
+	Messages   []ChatMessage `json:"messages"`
+	Tools      []openAITool  `json:"tools,omitempty"`
+	ToolChoice interface{}   `json:"tool_choice,omitempty"`
+	Stream     bool          `json:"stream"`
+}
+
+// OpenAIChatResponse models the JSON response of a chat completions endpoint
+type OpenAIChatResponse struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Message struct {
+			Role      string `json:"role"`
+			Content   string `json:"content"`
+			ToolCalls []struct {
+				Function struct {
+					Name      string          `json:"name"`
+					Arguments json.RawMessage `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"message"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// OpenAISummarizer talks to any OpenAI-compatible /chat/completions endpoint
+// (OpenAI, Groq, Together, vLLM, LM Studio, ...).
+type OpenAISummarizer struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	HTTPClient *httpclient.Client
+}
+
+func NewOpenAISummarizer(baseURL, apiKey, model string) *OpenAISummarizer {
+	if baseURL == "" {
+		baseURL = defaultOpenAIBaseURL
+	}
+	if model == "" {
+		model = defaultOpenAIChatModel
+	}
+	return &OpenAISummarizer{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: providerClient("OpenAI API", httpclient.DefaultOptions()),
+	}
+}
+
+func (oa *OpenAISummarizer) Summarize(ctx context.Context, sr SummaryRequest) (*SummaryResponse, error) {
+	var chatResp OpenAIChatResponse
+	if err := postJSON(ctx, oa.HTTPClient, "OpenAI API", oa.BaseURL+"/chat/completions", oa.APIKey, oa.request(sr, false), &chatResp); err != nil {
+		return nil, err
+	}
+	if len(chatResp.Choices) == 0 {
+		return nil, errors.New("openAI API returned no choices")
+	}
+
+	choice := chatResp.Choices[0]
+	resp := &SummaryResponse{
+		Provider:     SummarizerProviderOpenAI,
+		Model:        chatResp.Model,
+		Content:      choice.Message.Content,
+		FinishReason: choice.FinishReason,
+	}
+	if len(choice.Message.ToolCalls) > 0 {
+		resp.Arguments = functionArguments(choice.Message.ToolCalls[0].Function.Arguments)
+	}
+	return resp, nil
+}
+
+// SummarizeStream is Summarize with the reply streamed to onDelta as it is written.
+func (oa *OpenAISummarizer) SummarizeStream(ctx context.Context, sr SummaryRequest, onDelta func(string)) (*SummaryResponse, error) {
+	body, err := postJSONStream(ctx, oa.HTTPClient, "OpenAI API", oa.BaseURL+"/chat/completions", oa.APIKey, oa.request(sr, true))
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+
+	resp, err := readChatStream(body, SummarizerProviderOpenAI, onDelta)
+	if err != nil {
+		return nil, fmt.Errorf("openAI API: %v", err)
+	}
+	return resp, nil
+}
+
+func (oa *OpenAISummarizer) request(sr SummaryRequest, stream bool) openAIChatRequest {
+	payload := openAIChatRequest{
+		Model:    oa.Model,
+		Messages: sr.Messages,
+		Stream:   stream,
+	}
+	if sr.Function != nil {
+		payload.Tools = []openAITool{{
+			Type: "function",
+			Function: openAIToolFunction{
+				Name:        sr.Function.Name,
+				Description: sr.Function.Description,
+				Parameters:  sr.Function.Parameters,
+			},
+		}}
+		// Force the model to call our function
+		payload.ToolChoice = map[string]interface{}{
+			"type":     "function",
+			"function": map[string]string{"name": sr.Function.Name},
+		}
+	}
+	return payload
+}
@@ -0,0 +1,30 @@
+package service
+
+import (
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+// providerClient returns the HTTP client for a transcription or summarizer
+// provider. Those calls have no side effects, so failed POSTs are retried too.
+func providerClient(name string, opts httpclient.Options) *httpclient.Client {
+	client := httpclient.New(name, opts)
+	client.Idempotent = true
+	return client
+}
+
+// httpOptions applies the HTTP_* and BREAKER_* settings to the default client options.
+func httpOptions(config *Config) httpclient.Options {
+	opts := httpclient.DefaultOptions()
+	opts.Timeout = config.HTTPTimeout
+	opts.MaxRetries = config.HTTPMaxRetries
+	opts.BaseDelay = config.HTTPRetryBaseDelay
+	opts.MaxDelay = config.HTTPRetryMaxDelay
+	opts.FailureThreshold = config.BreakerFailureThreshold
+	opts.OpenTimeout = config.BreakerOpenTimeout
+	return opts
+}
+
+// ProviderStatus returns the circuit breaker state of every provider we have talked to.
+func (us *UserService) ProviderStatus() []httpclient.BreakerStatus {
+	return httpclient.Breakers.Statuses()
+}
@@ -0,0 +1,241 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+	"github.com/cyberhawk12121/Saarthi/internal/storage"
+)
+
+const (
+	// multipartPartSize is the size of every part but the last one of a
+	// presigned multipart upload. S3 wants at least 5MB.
+	multipartPartSize = 10 * 1024 * 1024
+	// singlePutLimit is the biggest file we let the client send in one PUT.
+	singlePutLimit = 50 * 1024 * 1024
+)
+
+var (
+	ErrRecordingNotFound = errors.New("recording not found")
+	ErrUploadTooLarge    = fmt.Errorf("recordings are limited to %d bytes", maxUploadSize)
+	// ErrUploadIncomplete means the client called complete before the object was in storage.
+	ErrUploadIncomplete = errors.New("the recording has not been uploaded yet")
+	// ErrAlreadyUploaded means the upload was completed before and is being processed.
+	ErrAlreadyUploaded = errors.New("the recording has already been uploaded")
+)
+
+// CreateRecordingUpload creates the recording and presigns the URLs the client
+// uploads it to. With S3 the bytes go straight to the bucket without passing
+// through us.
+func (us *UserService) CreateRecordingUpload(ctx context.Context, userId string, req types.CreateRecordingRequest) (types.CreateRecordingResponse, error) {
+	if req.Size > maxUploadSize {
+		return types.CreateRecordingResponse{}, ErrUploadTooLarge
+	}
+
+	language, err := us.recordingLanguage(userId, req.Language)
+	if err != nil {
+		return types.CreateRecordingResponse{}, err
+	}
+
+	recording, err := us.recordingRepo.CreateRecording(userId, language)
+	if err != nil {
+		return types.CreateRecordingResponse{}, fmt.Errorf("error creating recording: %v", err)
+	}
+	key := recording.StorageKey
+	resp := types.CreateRecordingResponse{
+		RecordingID: recording.ID,
+		Key:         key,
+		ExpiresAt:   time.Now().Add(us.config.PresignTTL).Format(time.RFC3339),
+	}
+
+	//-------------------------------------------------------------------
+	// Big files: start a multipart upload and presign every part, if the
+	// store can take one
+	//-------------------------------------------------------------------
+	multipart, ok := us.store.(storage.MultipartStore)
+	if ok && (req.Multipart || req.Size > singlePutLimit) {
+		uploadId, urls, err := multipart.PresignMultipart(ctx, key, req.ContentType, req.Size, multipartPartSize, us.config.PresignTTL)
+		if err != nil {
+			return types.CreateRecordingResponse{}, err
+		}
+		resp.UploadID = uploadId
+		resp.PartSize = multipartPartSize
+		for i, partURL := range urls {
+			resp.Parts = append(resp.Parts, types.PresignedPart{PartNumber: int32(i + 1), URL: partURL})
+		}
+		return resp, nil
+	}
+
+	//-------------------------------------------------------------------
+	// Small files (and stores without multipart): a single presigned PUT
+	//-------------------------------------------------------------------
+	uploadURL, err := us.store.Presign(ctx, http.MethodPut, key, us.config.PresignTTL)
+	if err != nil {
+		return types.CreateRecordingResponse{}, fmt.Errorf("error presigning upload: %v", err)
+	}
+	resp.UploadURL = uploadURL
+	return resp, nil
+}
+
+// CompleteRecordingUpload is called by the client once the upload is done. It
+// finishes a multipart upload, checks the object is really there, marks the
+// recording as uploaded and starts a transcription job for it.
+func (us *UserService) CompleteRecordingUpload(ctx context.Context, userId string, recordingId int, req types.CompleteRecordingRequest) (string, error) {
+	recording, err := us.recordingRepo.GetRecording(recordingId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && recording.UserID != userId) {
+		return "", ErrRecordingNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	// A retried or replayed call must not start a second job
+	if recording.Uploaded {
+		return "", ErrAlreadyUploaded
+	}
+
+	key := recording.StorageKey
+
+	//-------------------------------------------------------------------
+	// 1. Stitch the parts together if it was a multipart upload
+	//-------------------------------------------------------------------
+	if req.UploadID != "" {
+		multipart, ok := us.store.(storage.MultipartStore)
+		if !ok || len(req.Parts) == 0 {
+			return "", ErrUploadIncomplete
+		}
+		parts := make([]storage.Part, 0, len(req.Parts))
+		for _, p := range req.Parts {
+			parts = append(parts, storage.Part{Number: p.PartNumber, ETag: p.ETag})
+		}
+		if err := multipart.CompleteMultipart(ctx, key, req.UploadID, parts); err != nil {
+			return "", err
+		}
+	}
+
+	//-------------------------------------------------------------------
+	// 2. Make sure the object is there and not too big
+	//-------------------------------------------------------------------
+	info, err := us.store.Head(ctx, key)
+	if errors.Is(err, storage.ErrNotFound) {
+		return "", ErrUploadIncomplete
+	}
+	if err != nil {
+		return "", fmt.Errorf("error checking upload: %v", err)
+	}
+	if info.Size > maxUploadSize {
+		return "", ErrUploadTooLarge
+	}
+
+	//-------------------------------------------------------------------
+	// 3. Transcribe it in the background, reading it back from storage
+	//-------------------------------------------------------------------
+	run, err := us.withOverrides(types.ReprocessRequest{Language: recording.Language})
+	if err != nil {
+		return "", err
+	}
+	// Only the call that marks the recording as uploaded gets to start its job
+	jobId, err := us.jobRepo.CreateUploadJob(recordingId, info.ETag)
+	if errors.Is(err, sql.ErrNoRows) {
+		return "", ErrAlreadyUploaded
+	}
+	if err != nil {
+		return "", fmt.Errorf("error creating job: %v", err)
+	}
+	go run.processStoredRecording(jobId, recording)
+
+	return jobId, nil
+}
+
+// processStoredRecording runs the job for a recording that is already in storage.
+func (us *UserService) processStoredRecording(jobId string, recording model.Recording) {
+	ctx := context.Background()
+	us.events.Publish(recording.ID, EventStage, types.StageEvent{JobID: jobId, Stage: model.JobStageUploading})
+
+	obj, err := us.store.Get(ctx, recording.StorageKey)
+	if err != nil {
+		us.failJob(jobId, recording.ID, fmt.Errorf("error reading recording from storage: %v", err))
+		return
+	}
+	defer obj.Close()
+
+	transcript, err := us.chunkedTranscription(ctx, obj, recording.StorageKey, us.jobProgress(jobId, recording.ID), us.chunkTranscribed(jobId, recording.ID))
+	if err != nil {
+		us.failJob(jobId, recording.ID, fmt.Errorf("transcription failed: %v", err))
+		return
+	}
+	us.finishJob(ctx, jobId, recording.ID, recording.UserID, transcript)
+}
+
+// ReprocessRecording transcribes and summarizes a stored recording again, for
+// instance after a failed job, and stores the result as a new summary version.
+// The audio is read straight from storage into memory, nothing is written to
+// disk.
+func (us *UserService) ReprocessRecording(userId string, recordingId int, req types.ReprocessRequest) (string, error) {
+	recording, err := us.recordingRepo.GetRecording(recordingId)
+	if errors.Is(err, sql.ErrNoRows) || (err == nil && recording.UserID != userId) {
+		return "", ErrRecordingNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	if !recording.Uploaded {
+		return "", ErrUploadIncomplete
+	}
+
+	// Keep the language the recording was uploaded with unless told otherwise
+	if req.Language == "" {
+		req.Language = recording.Language
+	}
+	run, err := us.withOverrides(req)
+	if err != nil {
+		return "", err
+	}
+
+	jobId, err := us.jobRepo.CreateJob(recording.ID, userId)
+	if err != nil {
+		return "", fmt.Errorf("error creating job: %v", err)
+	}
+	go run.processStoredRecording(jobId, recording)
+
+	return jobId, nil
+}
+
+// withOverrides returns a copy of the service that transcribes and summarizes
+// with the models and language of req. Without overrides it returns us.
+func (us *UserService) withOverrides(req types.ReprocessRequest) (*UserService, error) {
+	if req.TranscriptionModel == "" && req.SummarizerModel == "" && req.Language == "" {
+		return us, nil
+	}
+
+	config := *us.config
+	if req.TranscriptionModel != "" {
+		config.TranscriptionModel = req.TranscriptionModel
+	}
+	if req.SummarizerModel != "" {
+		config.SummarizerModel = req.SummarizerModel
+	}
+	if req.Language != "" {
+		config.TranscriptionLanguage = req.Language
+	}
+
+	transcriber, err := NewTranscriber(&config)
+	if err != nil {
+		return nil, err
+	}
+	summarizer, err := NewSummarizer(&config)
+	if err != nil {
+		return nil, err
+	}
+
+	run := *us
+	run.config = &config
+	run.transcriber = transcriber
+	run.summarizer = summarizer
+	return &run, nil
+}
@@ -0,0 +1,298 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+// ResourceProvider finds links to read more about a topic of a meeting.
+// Backends are picked with RESOURCE_PROVIDER.
+type ResourceProvider interface {
+	Search(ctx context.Context, query string, limit int) ([]types.Resource, error)
+}
+
+const (
+	ResourceProviderNone    = "none"
+	ResourceProviderSearXNG = "searxng"
+	ResourceProviderStatic  = "static"
+)
+
+const defaultSearXNGBaseURL = "http://localhost:8888"
+
+// maxQueriesPerTopic is how many searches we run for one topic at most.
+const maxQueriesPerTopic = 2
+
+// NewResourceProvider builds the resource backend selected in the config, or
+// returns nil if there is none.
+func NewResourceProvider(config *Config) (ResourceProvider, error) {
+	switch config.ResourceProvider {
+	case "", ResourceProviderNone:
+		return nil, nil
+	case ResourceProviderSearXNG:
+		sp := NewSearXNGProvider(config.ResourceBaseURL)
+		sp.HTTPClient = providerClient(sp.HTTPClient.Name, httpOptions(config))
+		return sp, nil
+	case ResourceProviderStatic:
+		return LoadStaticResourceProvider(config.ResourceStaticFile)
+	default:
+		return nil, fmt.Errorf("unknown resource provider %q", config.ResourceProvider)
+	}
+}
+
+// SearXNGProvider searches the web through a SearXNG instance, which needs
+// the json format enabled in its settings.
+type SearXNGProvider struct {
+	BaseURL    string
+	HTTPClient *httpclient.Client
+}
+
+func NewSearXNGProvider(baseURL string) *SearXNGProvider {
+	if baseURL == "" {
+		baseURL = defaultSearXNGBaseURL
+	}
+	return &SearXNGProvider{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: providerClient("SearXNG", httpclient.DefaultOptions()),
+	}
+}
+
+func (sp *SearXNGProvider) Search(ctx context.Context, query string, limit int) ([]types.Resource, error) {
+	params := url.Values{"q": {query}, "format": {"json"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, sp.BaseURL+"/search?"+params.Encode(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error creating SearXNG request: %v", err)
+	}
+
+	resp, err := sp.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to SearXNG: %v", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading SearXNG response: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("SearXNG returned status %d: %s", resp.StatusCode, string(respBody))
+	}
+
+	var reply struct {
+		Results []struct {
+			Title   string `json:"title"`
+			URL     string `json:"url"`
+			Content string `json:"content"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(respBody, &reply); err != nil {
+		return nil, fmt.Errorf("error parsing SearXNG JSON: %v", err)
+	}
+
+	resources := make([]types.Resource, 0, limit)
+	for _, r := range reply.Results {
+		if len(resources) == limit {
+			break
+		}
+		resources = append(resources, types.Resource{Title: r.Title, URL: r.URL, Snippet: r.Content})
+	}
+	return resources, nil
+}
+
+// StaticResourceProvider searches a fixed list of resources without going
+// online, for tests and for teams that want meetings pointed at their own docs.
+type StaticResourceProvider struct {
+	Resources []types.Resource
+}
+
+func NewStaticResourceProvider(resources []types.Resource) *StaticResourceProvider {
+	return &StaticResourceProvider{Resources: resources}
+}
+
+// LoadStaticResourceProvider reads the resources from a JSON list of
+// {"title", "url", "snippet"} objects.
+func LoadStaticResourceProvider(path string) (*StaticResourceProvider, error) {
+	if path == "" {
+		return nil, errors.New("RESOURCE_STATIC_FILE is not set")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("error reading static resources: %v", err)
+	}
+	var resources []types.Resource
+	if err := json.Unmarshal(data, &resources); err != nil {
+		return nil, fmt.Errorf("error parsing static resources %s: %v", path, err)
+	}
+	return NewStaticResourceProvider(resources), nil
+}
+
+// Search ranks the resources by how many words of the query their title and
+// snippet have, and returns those that have any.
+func (sp *StaticResourceProvider) Search(ctx context.Context, query string, limit int) ([]types.Resource, error) {
+	type match struct {
+		resource types.Resource
+		score    int
+	}
+
+	words := make(map[string]bool)
+	for _, w := range strings.Fields(query) {
+		// Short words like "a" or "of" match everything
+		if w = normalizeWord(w); len(w) > 2 {
+			words[w] = true
+		}
+	}
+
+	var matches []match
+	for _, r := range sp.Resources {
+		// Every word of the query counts once
+		found := make(map[string]bool)
+		for _, w := range strings.Fields(r.Title + " " + r.Snippet) {
+			if w = normalizeWord(w); words[w] {
+				found[w] = true
+			}
+		}
+		if len(found) > 0 {
+			matches = append(matches, match{resource: r, score: len(found)})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool { return matches[i].score > matches[j].score })
+
+	resources := make([]types.Resource, 0, limit)
+	for _, m := range matches {
+		if len(resources) == limit {
+			break
+		}
+		resources = append(resources, m.resource)
+	}
+	return resources, nil
+}
+
+const resourcePrompt = `You are an assistant that helps people follow up on their meetings.
+You will be given the summary of a meeting as JSON. Pick the topics someone who was in the meeting would want to read more about, and call the propose_resources function with them.
+- Only pick topics the meeting actually discussed, at most %d of them.
+- Prefer technologies, methods, standards and concepts over people, dates or internal projects.
+- Give every topic one or two web search queries that would find a good introduction or reference.
+- Leave the list empty if nothing is worth looking up.`
+
+// resourceFunction is what the LLM fills in with the topics of a meeting.
+var resourceFunction = SummaryFunction{
+	Name:        "propose_resources",
+	Description: "Propose topics of a meeting to read more about",
+	Parameters: map[string]interface{}{
+		"type": "object",
+		"properties": map[string]interface{}{
+			"topics": map[string]interface{}{
+				"type":        "array",
+				"description": "Topics worth reading more about",
+				"items": map[string]interface{}{
+					"type": "object",
+					"properties": map[string]interface{}{
+						"topic": map[string]interface{}{
+							"type":        "string",
+							"description": "The topic, in a few words",
+						},
+						"queries": stringList("Web search queries that find resources on the topic"),
+					},
+					"required": []string{"topic", "queries"},
+				},
+			},
+		},
+		"required": []string{"topics"},
+	},
+}
+
+// findResources asks the LLM which topics of the meeting are worth reading
+// more about and looks them up with the ResourceProvider. Resources are a nice
+// to have, so failures are logged and the summary goes on without them.
+func (us *UserService) findResources(ctx context.Context, summary *types.MeetingSummary) []types.ResourceTopic {
+	if us.resources == nil {
+		return nil
+	}
+
+	topics, err := us.proposeTopics(ctx, summary)
+	if err != nil {
+		log.Printf("error proposing topics to look up: %v", err)
+		return nil
+	}
+
+	limit := max(1, us.config.ResourcesPerTopic)
+	var found []types.ResourceTopic
+	for _, topic := range topics {
+		topic.Resources = make([]types.Resource, 0, limit)
+		seen := make(map[string]bool)
+		for _, query := range topic.Queries {
+			results, err := us.resources.Search(ctx, query, limit)
+			if err != nil {
+				log.Printf("error looking up %q: %v", query, err)
+				continue
+			}
+			for _, r := range results {
+				if r.URL == "" || seen[r.URL] || len(topic.Resources) == limit {
+					continue
+				}
+				seen[r.URL] = true
+				topic.Resources = append(topic.Resources, r)
+			}
+		}
+		if len(topic.Resources) > 0 {
+			found = append(found, topic)
+		}
+	}
+	return found
+}
+
+// proposeTopics asks the LLM for the topics of the summary worth looking up.
+func (us *UserService) proposeTopics(ctx context.Context, summary *types.MeetingSummary) ([]types.ResourceTopic, error) {
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return nil, err
+	}
+	maxTopics := max(1, us.config.ResourceTopics)
+
+	resp, err := us.summarizer.Summarize(ctx, SummaryRequest{
+		Messages: []ChatMessage{
+			{Role: "system", Content: fmt.Sprintf(resourcePrompt, maxTopics)},
+			{Role: "user", Content: string(content)},
+		},
+		Function: &resourceFunction,
+	})
+	if err != nil {
+		return nil, err
+	}
+	raw, err := replyJSON(resp)
+	if err != nil {
+		return nil, fmt.Errorf("invalid topics from %s (%s): %v", resp.Provider, resp.Model, err)
+	}
+
+	var reply struct {
+		Topics []types.ResourceTopic `json:"topics"`
+	}
+	if err := json.Unmarshal(raw, &reply); err != nil {
+		return nil, fmt.Errorf("error parsing topics JSON: %v", err)
+	}
+
+	topics := make([]types.ResourceTopic, 0, len(reply.Topics))
+	for _, topic := range reply.Topics {
+		topic.Topic = strings.TrimSpace(topic.Topic)
+		topic.Queries = cleanList(topic.Queries)
+		if len(topic.Queries) > maxQueriesPerTopic {
+			topic.Queries = topic.Queries[:maxQueriesPerTopic]
+		}
+		if topic.Topic == "" || len(topic.Queries) == 0 || len(topics) == maxTopics {
+			continue
+		}
+		topics = append(topics, topic)
+	}
+	return topics, nil
+}
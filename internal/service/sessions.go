@@ -0,0 +1,114 @@
+package service
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid or expired refresh token")
+	// ErrRefreshTokenReused means an already rotated token came back, so it was
+	// probably stolen. The whole session is signed out when this happens.
+	ErrRefreshTokenReused = errors.New("refresh token has already been used, session signed out")
+	ErrSessionNotFound    = errors.New("session not found")
+)
+
+// RefreshTokens swaps a refresh token for a new access/refresh token pair. Every
+// refresh token works once: presenting one a second time revokes its session.
+func (us *UserService) RefreshTokens(refreshToken string) (types.LoginResponse, error) {
+	claims, err := us.auth.ParseRefreshToken(refreshToken)
+	if err != nil || !isUUID(claims.ID) {
+		return types.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	token, err := us.refreshRepo.GetRefreshToken(claims.ID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return types.LoginResponse{}, ErrInvalidRefreshToken
+	}
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+
+	session, err := us.refreshRepo.GetSession(token.SessionID)
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+	if session.RevokedAt != nil || time.Now().After(token.ExpiresAt) {
+		return types.LoginResponse{}, ErrInvalidRefreshToken
+	}
+
+	// Consuming the token is atomic, so two concurrent refreshes with the same
+	// token can't both win
+	fresh, err := us.refreshRepo.MarkRefreshTokenUsed(token.ID)
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+	if !fresh {
+		if _, err := us.refreshRepo.RevokeSession(session.ID, session.UserID); err != nil {
+			log.Printf("error revoking session %s after refresh token reuse: %v", session.ID, err)
+		}
+		return types.LoginResponse{}, ErrRefreshTokenReused
+	}
+
+	if err := us.refreshRepo.TouchSession(session.ID); err != nil {
+		log.Printf("error updating session %s: %v", session.ID, err)
+	}
+	return us.issueTokens(session.UserID, session.ID)
+}
+
+// Logout signs out the session the request was made with.
+func (us *UserService) Logout(userId string, sessionId string) error {
+	_, err := us.refreshRepo.RevokeSession(sessionId, userId)
+	return err
+}
+
+// IssueStreamToken returns a short-lived token for the session that browsers
+// put in the URL of event streams and live sessions.
+func (us *UserService) IssueStreamToken(userId string, sessionId string) (types.StreamTokenResponse, error) {
+	token, expiresAt, err := us.auth.IssueStreamToken(userId, sessionId)
+	if err != nil {
+		return types.StreamTokenResponse{}, err
+	}
+	return types.StreamTokenResponse{Token: token, ExpiresAt: expiresAt.Format(time.RFC3339)}, nil
+}
+
+// ListSessions returns the user's signed-in devices, flagging the current one.
+func (us *UserService) ListSessions(userId string, currentSessionId string) ([]types.SessionResponse, error) {
+	sessions, err := us.refreshRepo.ListActiveSessions(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := make([]types.SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		resp = append(resp, types.SessionResponse{
+			ID:         s.ID,
+			UserAgent:  s.UserAgent,
+			IPAddress:  s.IPAddress,
+			Current:    s.ID == currentSessionId,
+			CreatedAt:  s.CreatedAt.Format(time.RFC3339),
+			LastUsedAt: s.LastUsedAt.Format(time.RFC3339),
+		})
+	}
+	return resp, nil
+}
+
+// RevokeSession signs out one of the user's sessions, e.g. a lost device.
+func (us *UserService) RevokeSession(userId string, sessionId string) error {
+	if !isUUID(sessionId) {
+		return ErrSessionNotFound
+	}
+	revoked, err := us.refreshRepo.RevokeSession(sessionId, userId)
+	if err != nil {
+		return fmt.Errorf("error revoking session: %v", err)
+	}
+	if !revoked {
+		return ErrSessionNotFound
+	}
+	return nil
+}
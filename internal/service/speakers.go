@@ -0,0 +1,198 @@
+package service
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+// ErrSpeakerNotFound is returned when the transcript has no such speaker label.
+var ErrSpeakerNotFound = errors.New("speaker not found")
+
+// RenameSpeaker names the participant behind a speaker label of the summary's
+// transcript, and credits them by that name instead of the label or the name
+// they had before, in every version of the summary written from that
+// transcript. Returns sql.ErrNoRows if the user has no
+// such summary.
+func (us *UserService) RenameSpeaker(summaryId int, userId string, req types.RenameSpeakerRequest) (types.SummaryDetailResponse, error) {
+	if !isUUID(userId) {
+		return types.SummaryDetailResponse{}, sql.ErrNoRows
+	}
+	label := strings.TrimSpace(req.Label)
+	name := strings.TrimSpace(req.Name)
+
+	//-------------------------------------------------------------------
+	// 1. Find the speaker in the summary's transcript
+	//-------------------------------------------------------------------
+	s, err := us.summaryRepo.GetSummaryById(summaryId, userId)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+
+	segments, err := us.transcriptRepo.GetSegmentsByTranscriptId(s.TranscriptID)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+	if !hasSpeaker(segments, label) {
+		return types.SummaryDetailResponse{}, ErrSpeakerNotFound
+	}
+
+	names, err := us.transcriptRepo.GetSpeakerNames(s.TranscriptID)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+	previous := label
+	if n, ok := names[label]; ok {
+		previous = n
+	}
+
+	//-------------------------------------------------------------------
+	// 2. Credit the new name in every version written from the transcript,
+	//    they all share its speaker names
+	//-------------------------------------------------------------------
+	tx, err := us.DB.Begin()
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+	defer tx.Rollback()
+
+	// Keep new versions of the recording out until the rename is done
+	if err := us.recordingRepo.LockRecording(tx, s.RecordingID); err != nil {
+		return types.SummaryDetailResponse{}, fmt.Errorf("error locking recording: %v", err)
+	}
+	if previous != name {
+		versions, err := us.summaryRepo.ListSummariesByTranscriptTx(tx, s.TranscriptID, userId)
+		if err != nil {
+			return types.SummaryDetailResponse{}, err
+		}
+		for _, version := range versions {
+			if err := us.renameInVersion(tx, version, userId, previous, name); err != nil {
+				return types.SummaryDetailResponse{}, err
+			}
+		}
+	}
+
+	//-------------------------------------------------------------------
+	// 3. Remember the name for the transcript
+	//-------------------------------------------------------------------
+	if err := us.transcriptRepo.SetSpeakerName(tx, s.TranscriptID, label, name); err != nil {
+		return types.SummaryDetailResponse{}, fmt.Errorf("error saving speaker name: %v", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return types.SummaryDetailResponse{}, fmt.Errorf("error saving speaker name: %v", err)
+	}
+
+	return us.GetSummary(summaryId, userId)
+}
+
+// renameInVersion credits new instead of old in one version of a summary and
+// its action items, as part of tx.
+func (us *UserService) renameInVersion(tx *sql.Tx, s model.Summary, userId string, old, new string) error {
+	var summary types.MeetingSummary
+	if err := json.Unmarshal(s.Content, &summary); err != nil {
+		return fmt.Errorf("error parsing stored summary %d: %v", s.ID, err)
+	}
+	renameInSummary(&summary, old, new)
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return err
+	}
+	err = us.summaryRepo.UpdateSummaryContent(tx, model.Summary{
+		ID:      s.ID,
+		Title:   summary.Title,
+		TLDR:    summary.TLDR,
+		Content: content,
+	})
+	if err != nil {
+		return fmt.Errorf("error updating summary %d: %v", s.ID, err)
+	}
+	if err := us.renameAssignees(tx, s.ID, userId, old, new); err != nil {
+		return fmt.Errorf("error updating the action items of summary %d: %v", s.ID, err)
+	}
+	return nil
+}
+
+// renameAssignees hands the summary's action items of old over to new, the
+// same way renameInSummary does with their owners, as part of tx.
+func (us *UserService) renameAssignees(tx *sql.Tx, summaryId int, userId string, old, new string) error {
+	items, err := us.actionItemRepo.ListActionItemsBySummaryTx(tx, summaryId, userId)
+	if err != nil {
+		return err
+	}
+	pattern := namePattern(old)
+	for _, item := range items {
+		assignee := pattern.ReplaceAllLiteralString(item.Assignee, new)
+		if assignee == item.Assignee {
+			continue
+		}
+		item.Assignee = assignee
+		if err := us.actionItemRepo.UpdateActionItem(tx, item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func hasSpeaker(segments []model.TranscriptSegment, label string) bool {
+	for _, s := range segments {
+		if s.Speaker == label {
+			return true
+		}
+	}
+	return false
+}
+
+// renameInSummary replaces every mention of old with new in the summary's text.
+func renameInSummary(summary *types.MeetingSummary, old, new string) {
+	pattern := namePattern(old)
+	rename := func(s *string) {
+		*s = pattern.ReplaceAllLiteralString(*s, new)
+	}
+	renameAll := func(list []string) {
+		for i := range list {
+			rename(&list[i])
+		}
+	}
+
+	rename(&summary.Title)
+	rename(&summary.TLDR)
+	renameAll(summary.KeyPoints)
+	renameAll(summary.Decisions)
+	renameAll(summary.OpenQuestions)
+	for i := range summary.ActionItems {
+		rename(&summary.ActionItems[i].Description)
+		rename(&summary.ActionItems[i].Owner)
+	}
+	for i := range summary.Sections {
+		rename(&summary.Sections[i].Title)
+		rename(&summary.Sections[i].TLDR)
+	}
+}
+
+// namePattern matches name as a whole word, so renaming "Speaker 1" leaves
+// "Speaker 10" alone.
+func namePattern(name string) *regexp.Regexp {
+	expr := regexp.QuoteMeta(name)
+	if first, _ := utf8.DecodeRuneInString(name); isWordRune(first) {
+		expr = `\b` + expr
+	}
+	if last, _ := utf8.DecodeLastRuneInString(name); isWordRune(last) {
+		expr += `\b`
+	}
+	return regexp.MustCompile(expr)
+}
+
+// isWordRune reports whether \b treats r as part of a word. Go's \b only
+// knows ASCII word characters.
+func isWordRune(r rune) bool {
+	return r < utf8.RuneSelf && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
@@ -0,0 +1,332 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/model"
+	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+)
+
+const (
+	defaultSummaryPageSize = 20
+	maxSummaryPageSize     = 100
+	recordingURLTTL        = time.Hour
+)
+
+// saveSummary stores the transcript and its summary for the recording, as a
+// new version if it already has one, and returns the ID of the new summary.
+// Everything is written in one transaction, a failure leaves nothing behind.
+func (us *UserService) saveSummary(recordingId int, userId string, transcript Transcript, summary *types.MeetingSummary) (int, error) {
+	segments := make([]model.TranscriptSegment, 0, len(transcript.Segments))
+	for _, s := range transcript.Segments {
+		segment := model.TranscriptSegment{Start: s.Start.Seconds(), End: s.End.Seconds(), Text: s.Text, Speaker: s.Speaker}
+		if s.Confidence > 0 {
+			confidence := s.Confidence
+			segment.Confidence = &confidence
+		}
+		segments = append(segments, segment)
+	}
+
+	tx, err := us.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	transcriptId, err := us.transcriptRepo.CreateTranscript(tx, recordingId, transcript.Text, segments)
+	if err != nil {
+		return 0, fmt.Errorf("error saving transcript: %v", err)
+	}
+	summaryId, err := us.createSummary(tx, recordingId, transcriptId, userId, summary)
+	if err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("error saving summary: %v", err)
+	}
+	return summaryId, nil
+}
+
+// createSummary stores a summary of a transcript that is already saved, as a
+// new version for the recording, along with its action items, as part of tx.
+// It returns the ID of the summary.
+func (us *UserService) createSummary(tx *sql.Tx, recordingId int, transcriptId int, userId string, summary *types.MeetingSummary) (int, error) {
+	// Versions are numbered from the one before, writers of the same
+	// recording have to take turns
+	if err := us.recordingRepo.LockRecording(tx, recordingId); err != nil {
+		return 0, fmt.Errorf("error locking recording: %v", err)
+	}
+	// What the user tracked on the version this one replaces
+	previous, err := us.actionItemRepo.ListActionItemsByRecordingTx(tx, recordingId, userId)
+	if err != nil {
+		return 0, fmt.Errorf("error reading action items: %v", err)
+	}
+	carryOverAssignees(summary, previous)
+
+	content, err := json.Marshal(summary)
+	if err != nil {
+		return 0, err
+	}
+
+	summaryId, err := us.summaryRepo.CreateSummary(tx, model.Summary{
+		RecordingID:  recordingId,
+		TranscriptID: transcriptId,
+		UserID:       userId,
+		Title:        summary.Title,
+		TLDR:         summary.TLDR,
+		Content:      content,
+	})
+	if err != nil {
+		return 0, fmt.Errorf("error saving summary: %v", err)
+	}
+	if err := us.saveActionItems(tx, recordingId, summaryId, userId, summary, previous); err != nil {
+		return 0, fmt.Errorf("error saving action items: %v", err)
+	}
+	return summaryId, nil
+}
+
+// ListSummaries returns a page (starting at 1) of the user's summaries, newest first.
+func (us *UserService) ListSummaries(userId string, page int, limit int) (types.SummaryPage, error) {
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 {
+		limit = defaultSummaryPageSize
+	}
+	if limit > maxSummaryPageSize {
+		limit = maxSummaryPageSize
+	}
+
+	resp := types.SummaryPage{
+		Summaries: []types.SummarylistResponse{},
+		Page:      page,
+		Limit:     limit,
+	}
+	if !isUUID(userId) {
+		return resp, nil
+	}
+
+	summaries, total, err := us.summaryRepo.ListSummariesByUser(userId, limit, (page-1)*limit)
+	if err != nil {
+		return types.SummaryPage{}, err
+	}
+
+	resp.Total = total
+	for _, s := range summaries {
+		resp.Summaries = append(resp.Summaries, summaryListItem(s))
+	}
+	return resp, nil
+}
+
+// ListSummaryVersions returns every version of the summary of the user's
+// recording, newest first.
+func (us *UserService) ListSummaryVersions(recordingId int, userId string) ([]types.SummarylistResponse, error) {
+	if !isUUID(userId) {
+		return []types.SummarylistResponse{}, nil
+	}
+
+	summaries, err := us.summaryRepo.ListSummaryVersions(recordingId, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	versions := []types.SummarylistResponse{}
+	for _, s := range summaries {
+		versions = append(versions, summaryListItem(s))
+	}
+	return versions, nil
+}
+
+func summaryListItem(s model.Summary) types.SummarylistResponse {
+	return types.SummarylistResponse{
+		ID:          s.ID,
+		RecordingID: s.RecordingID,
+		Title:       s.Title,
+		Description: s.TLDR,
+		Version:     s.Version,
+		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
+	}
+}
+
+// GetSummary returns the user's summary with its transcript, or sql.ErrNoRows.
+func (us *UserService) GetSummary(id int, userId string) (types.SummaryDetailResponse, error) {
+	if !isUUID(userId) {
+		return types.SummaryDetailResponse{}, sql.ErrNoRows
+	}
+
+	s, err := us.summaryRepo.GetSummaryById(id, userId)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+
+	transcript, err := us.transcriptRepo.GetTranscriptById(s.TranscriptID)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+
+	segments, err := us.transcriptRepo.GetSegmentsByTranscriptId(s.TranscriptID)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+	names, err := us.transcriptRepo.GetSpeakerNames(s.TranscriptID)
+	if err != nil {
+		return types.SummaryDetailResponse{}, err
+	}
+
+	resp := types.SummaryDetailResponse{
+		ID:          s.ID,
+		RecordingID: s.RecordingID,
+		Version:     s.Version,
+		Transcript:  transcript.Text,
+		Segments:    make([]types.TranscriptSegment, 0, len(segments)),
+		Speakers:    []types.Speaker{},
+		CreatedAt:   s.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:   s.UpdatedAt.Format(time.RFC3339),
+	}
+	seen := make(map[string]bool)
+	for _, segment := range segments {
+		speaker := segment.Speaker
+		if name, ok := names[speaker]; ok {
+			speaker = name
+		}
+		resp.Segments = append(resp.Segments, types.TranscriptSegment{
+			Start:      segment.Start,
+			End:        segment.End,
+			Text:       segment.Text,
+			Confidence: segment.Confidence,
+			Speaker:    speaker,
+		})
+
+		if segment.Speaker != "" && !seen[segment.Speaker] {
+			seen[segment.Speaker] = true
+			resp.Speakers = append(resp.Speakers, types.Speaker{Label: segment.Speaker, Name: names[segment.Speaker]})
+		}
+	}
+	if recording, err := us.recordingRepo.GetRecording(s.RecordingID); err == nil {
+		resp.AudioURL = us.recordingURL(recording)
+		resp.Language = recording.DetectedLanguage
+	}
+
+	if err := json.Unmarshal(s.Content, &resp.Summary); err != nil {
+		return types.SummaryDetailResponse{}, fmt.Errorf("error parsing stored summary %d: %v", s.ID, err)
+	}
+	return resp, nil
+}
+
+// RegenerateSummary summarizes the transcript of the user's summary again and
+// stores the result as a new version, with the summarizer model of req if
+// given. The summary is streamed to onDelta while the LLM writes it, and
+// cancelling ctx stops the LLM; once it has finished, the version is stored
+// with its resources either way. Returns sql.ErrNoRows if the user has no
+// such summary.
+func (us *UserService) RegenerateSummary(ctx context.Context, summaryId int, userId string, req types.RegenerateSummaryRequest, onDelta func(string)) (types.SummaryEvent, error) {
+	if !isUUID(userId) {
+		return types.SummaryEvent{}, sql.ErrNoRows
+	}
+
+	//-------------------------------------------------------------------
+	// 1. Load the transcript the summary was written from
+	//-------------------------------------------------------------------
+	s, err := us.summaryRepo.GetSummaryById(summaryId, userId)
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	transcript, err := us.loadTranscript(s.TranscriptID)
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	recording, err := us.recordingRepo.GetRecording(s.RecordingID)
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	transcript.Language = recording.DetectedLanguage
+	if transcript.Language == "" && recording.Language != LanguageAuto {
+		transcript.Language = recording.Language
+	}
+
+	//-------------------------------------------------------------------
+	// 2. Summarize it again, and look up resources on it
+	//-------------------------------------------------------------------
+	run, err := us.withOverrides(types.ReprocessRequest{SummarizerModel: req.SummarizerModel})
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	summary, err := run.summarize(ctx, transcript, onDelta)
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	// The summary is written, from here on it is stored whole even if the
+	// client goes away: searches cut off by the disconnect would leave the
+	// new version without its resources
+	ctx = context.WithoutCancel(ctx)
+	summary.Resources = run.findResources(ctx, summary)
+
+	//-------------------------------------------------------------------
+	// 3. Store it as the newest version
+	//-------------------------------------------------------------------
+	tx, err := us.DB.Begin()
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	defer tx.Rollback()
+
+	id, err := us.createSummary(tx, s.RecordingID, s.TranscriptID, userId, summary)
+	if err != nil {
+		return types.SummaryEvent{}, err
+	}
+	if err := tx.Commit(); err != nil {
+		return types.SummaryEvent{}, fmt.Errorf("error saving summary: %v", err)
+	}
+	return types.SummaryEvent{SummaryID: id, Summary: *summary}, nil
+}
+
+// loadTranscript reads a stored transcript back, with the speakers under the
+// names the user gave them.
+func (us *UserService) loadTranscript(transcriptId int) (Transcript, error) {
+	t, err := us.transcriptRepo.GetTranscriptById(transcriptId)
+	if err != nil {
+		return Transcript{}, err
+	}
+	segments, err := us.transcriptRepo.GetSegmentsByTranscriptId(transcriptId)
+	if err != nil {
+		return Transcript{}, err
+	}
+	names, err := us.transcriptRepo.GetSpeakerNames(transcriptId)
+	if err != nil {
+		return Transcript{}, err
+	}
+
+	transcript := Transcript{Text: t.Text, Segments: make([]TranscriptSegment, 0, len(segments))}
+	for _, s := range segments {
+		segment := TranscriptSegment{Start: seconds(s.Start), End: seconds(s.End), Text: s.Text, Speaker: s.Speaker}
+		if name, ok := names[s.Speaker]; ok {
+			segment.Speaker = name
+		}
+		if s.Confidence != nil {
+			segment.Confidence = *s.Confidence
+		}
+		transcript.Segments = append(transcript.Segments, segment)
+	}
+	return transcript, nil
+}
+
+// recordingURL returns a short-lived link to the recording's audio, or "" if
+// it isn't in storage (yet).
+func (us *UserService) recordingURL(recording model.Recording) string {
+	if !recording.Uploaded || recording.StorageKey == "" {
+		return ""
+	}
+	url, err := us.store.Presign(context.Background(), http.MethodGet, recording.StorageKey, recordingURLTTL)
+	if err != nil {
+		log.Printf("error signing the URL of recording %d: %v", recording.ID, err)
+		return ""
+	}
+	return url
+}
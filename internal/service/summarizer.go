@@ -0,0 +1,250 @@
+package service
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+// ChatMessage is a single message of the prompt sent to the LLM.
+type ChatMessage struct {
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// SummaryFunction asks the LLM to reply with arguments matching a JSON schema
+// instead of free text.
+type SummaryFunction struct {
+	Name        string
+	Description string
+	Parameters  map[string]interface{}
+}
+
+type SummaryRequest struct {
+	Messages []ChatMessage
+	// Function is optional; when set the reply comes back in SummaryResponse.Arguments
+	Function *SummaryFunction
+}
+
+// SummaryResponse is the provider-independent reply of a Summarizer.
+type SummaryResponse struct {
+	Provider     string          `json:"provider"`
+	Model        string          `json:"model"`
+	Content      string          `json:"content,omitempty"`
+	Arguments    json.RawMessage `json:"arguments,omitempty"`
+	FinishReason string          `json:"finish_reason,omitempty"`
+}
+
+// Summarizer sends a prompt to an LLM. Backends are picked with
+// SUMMARIZER_PROVIDER, see NewSummarizer.
+type Summarizer interface {
+	Summarize(ctx context.Context, req SummaryRequest) (*SummaryResponse, error)
+}
+
+// StreamingSummarizer is a Summarizer that can hand out the reply while the
+// LLM writes it. onDelta gets every new piece of the reply: the function
+// arguments when SummaryRequest.Function is set, the content otherwise.
+type StreamingSummarizer interface {
+	Summarizer
+	SummarizeStream(ctx context.Context, req SummaryRequest, onDelta func(string)) (*SummaryResponse, error)
+}
+
+const (
+	SummarizerProviderLlama  = "llama"
+	SummarizerProviderOpenAI = "openai"
+	SummarizerProviderOllama = "ollama"
+)
+
+// NewSummarizer builds the LLM backend selected in the config.
+func NewSummarizer(config *Config) (Summarizer, error) {
+	switch config.SummarizerProvider {
+	case "", SummarizerProviderLlama:
+		apiKey := config.SummarizerAPIKey
+		if apiKey == "" {
+			apiKey = config.LlamaAPIKey
+		}
+		ls := NewLlamaSummarizer(config.SummarizerBaseURL, apiKey, config.SummarizerModel)
+		ls.HTTPClient = providerClient(ls.HTTPClient.Name, httpOptions(config))
+		return ls, nil
+	case SummarizerProviderOpenAI:
+		oa := NewOpenAISummarizer(config.SummarizerBaseURL, config.SummarizerAPIKey, config.SummarizerModel)
+		oa.HTTPClient = providerClient(oa.HTTPClient.Name, httpOptions(config))
+		return oa, nil
+	case SummarizerProviderOllama:
+		ol := NewOllamaSummarizer(config.SummarizerBaseURL, config.SummarizerModel)
+		ol.HTTPClient = providerClient(ol.HTTPClient.Name, httpOptions(config))
+		return ol, nil
+	default:
+		return nil, fmt.Errorf("unknown summarizer provider %q", config.SummarizerProvider)
+	}
+}
+
+// postJSON sends payload as JSON and decodes a 200 response into out. name is
+// only used in error messages.
+func postJSON(ctx context.Context, client *httpclient.Client, name string, url string, apiKey string, payload interface{}, out interface{}) error {
+	req, err := newJSONRequest(ctx, name, url, apiKey, payload)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error sending request to %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("error reading %s response: %v", name, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned status %d: %s", name, resp.StatusCode, string(respBody))
+	}
+
+	if err := json.Unmarshal(respBody, out); err != nil {
+		return fmt.Errorf("error parsing %s response: %v", name, err)
+	}
+	return nil
+}
+
+// postJSONStream sends payload as JSON and returns the body of a 200 response
+// to be read as it arrives. The caller closes it.
+func postJSONStream(ctx context.Context, client *httpclient.Client, name string, url string, apiKey string, payload interface{}) (io.ReadCloser, error) {
+	req, err := newJSONRequest(ctx, name, url, apiKey, payload)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := client.Stream(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to %s: %v", name, err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		respBody, _ := io.ReadAll(resp.Body)
+		return nil, fmt.Errorf("%s returned status %d: %s", name, resp.StatusCode, string(respBody))
+	}
+	return resp.Body, nil
+}
+
+func newJSONRequest(ctx context.Context, name string, url string, apiKey string, payload interface{}) (*http.Request, error) {
+	reqBodyBytes, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("error marshaling %s request: %v", name, err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewReader(reqBodyBytes))
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s request: %v", name, err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+	return req, nil
+}
+
+// chatStreamChunk is one event of a streamed OpenAI-style chat completion.
+// The Llama API streams function calls the old way, OpenAI as tool calls.
+type chatStreamChunk struct {
+	Model   string `json:"model"`
+	Choices []struct {
+		Delta struct {
+			Content      string `json:"content"`
+			FunctionCall *struct {
+				Arguments string `json:"arguments"`
+			} `json:"function_call"`
+			ToolCalls []struct {
+				Function struct {
+					Arguments string `json:"arguments"`
+				} `json:"function"`
+			} `json:"tool_calls"`
+		} `json:"delta"`
+		FinishReason string `json:"finish_reason"`
+	} `json:"choices"`
+}
+
+// readChatStream reads the server-sent events of a streamed chat completion
+// until [DONE], passing every piece of content or function arguments to
+// onDelta, and returns the whole reply. A stream that ends without [DONE] or
+// a finish reason was cut off, and is an error rather than a short reply.
+func readChatStream(body io.Reader, provider string, onDelta func(string)) (*SummaryResponse, error) {
+	resp := &SummaryResponse{Provider: provider}
+	var content, arguments strings.Builder
+	done := false
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		data = strings.TrimSpace(data)
+		if data == "[DONE]" {
+			done = true
+			break
+		}
+
+		var chunk chatStreamChunk
+		if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+			return nil, fmt.Errorf("error parsing stream event: %v", err)
+		}
+		if chunk.Model != "" {
+			resp.Model = chunk.Model
+		}
+		if len(chunk.Choices) == 0 {
+			continue
+		}
+
+		choice := chunk.Choices[0]
+		delta := choice.Delta.Content
+		content.WriteString(delta)
+		if choice.Delta.FunctionCall != nil {
+			delta += choice.Delta.FunctionCall.Arguments
+			arguments.WriteString(choice.Delta.FunctionCall.Arguments)
+		}
+		for _, call := range choice.Delta.ToolCalls {
+			delta += call.Function.Arguments
+			arguments.WriteString(call.Function.Arguments)
+		}
+		if delta != "" {
+			onDelta(delta)
+		}
+		if choice.FinishReason != "" {
+			resp.FinishReason = choice.FinishReason
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading stream: %v", err)
+	}
+	if !done && resp.FinishReason == "" {
+		return nil, errors.New("stream ended before the reply was complete")
+	}
+
+	resp.Content = content.String()
+	if arguments.Len() > 0 {
+		resp.Arguments = json.RawMessage(arguments.String())
+	}
+	return resp, nil
+}
+
+// functionArguments normalizes function call arguments: OpenAI sends them as a
+// JSON-encoded string, other providers as a plain JSON object.
+func functionArguments(raw json.RawMessage) json.RawMessage {
+	var encoded string
+	if err := json.Unmarshal(raw, &encoded); err == nil {
+		return json.RawMessage(encoded)
+	}
+	return raw
+}
@@ -0,0 +1,189 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"mime/multipart"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+// Transcriber turns a piece of audio into text. The segment times it returns
+// are relative to the start of that piece. Backends are picked with
+// TRANSCRIPTION_PROVIDER, see NewTranscriber.
+type Transcriber interface {
+	Transcribe(ctx context.Context, audio io.Reader, filename string) (Transcript, error)
+}
+
+const (
+	TranscriptionProviderLemonFox   = "lemonfox"
+	TranscriptionProviderOpenAI     = "openai"
+	TranscriptionProviderWhisperCpp = "whispercpp"
+)
+
+// NewTranscriber builds the transcription backend selected in the config.
+func NewTranscriber(config *Config) (Transcriber, error) {
+	language, err := normalizeLanguage(config.TranscriptionLanguage)
+	if err != nil {
+		return nil, err
+	}
+
+	// Every backend spells languages and auto-detection its own way
+	switch config.TranscriptionProvider {
+	case "", TranscriptionProviderLemonFox:
+		lf := NewLemonFoxClient(config.LemonFoxBaseURL, config.LemonFoxAPIKey)
+		switch language {
+		case "":
+		case LanguageAuto:
+			// LemonFox detects the language when it isn't given one
+			lf.Language = ""
+		default:
+			lf.Language = strings.ToLower(languageName(language))
+		}
+		lf.SpeakerLabels = config.TranscriptionDiarize
+		lf.HTTPClient = providerClient(lf.HTTPClient.Name, httpOptions(config))
+		return lf, nil
+	case TranscriptionProviderOpenAI:
+		wc := NewWhisperClient(config.TranscriptionBaseURL, config.TranscriptionAPIKey, config.TranscriptionModel)
+		if language != LanguageAuto {
+			wc.Language = language
+		}
+		wc.HTTPClient = providerClient(wc.HTTPClient.Name, httpOptions(config))
+		return wc, nil
+	case TranscriptionProviderWhisperCpp:
+		wc := NewWhisperCppClient(config.TranscriptionBaseURL)
+		// whisper.cpp takes "auto" as a language
+		wc.Language = language
+		wc.HTTPClient = providerClient(wc.HTTPClient.Name, httpOptions(config))
+		return wc, nil
+	default:
+		return nil, fmt.Errorf("unknown transcription provider %q", config.TranscriptionProvider)
+	}
+}
+
+// verboseTranscription is the verbose_json reply of OpenAI-compatible
+// transcription APIs, which LemonFox and whisper.cpp speak as well.
+type verboseTranscription struct {
+	Text string `json:"text"`
+	// Language is the detected language, a name ("german") or a code ("de")
+	// depending on the backend
+	Language string  `json:"language"`
+	Duration float64 `json:"duration"`
+	Segments []struct {
+		Start      float64  `json:"start"`
+		End        float64  `json:"end"`
+		Text       string   `json:"text"`
+		AvgLogprob *float64 `json:"avg_logprob"`
+		// Speaker is only set by backends that diarize, like LemonFox with speaker_labels
+		Speaker string `json:"speaker"`
+	} `json:"segments"`
+}
+
+// parseVerboseTranscription reads a verbose_json reply. A reply without
+// segments becomes a single segment over the whole piece of audio.
+func parseVerboseTranscription(name string, body []byte) (Transcript, error) {
+	var reply verboseTranscription
+	if err := json.Unmarshal(body, &reply); err != nil {
+		return Transcript{}, fmt.Errorf("error parsing %s JSON: %v", name, err)
+	}
+
+	transcript := Transcript{Text: strings.TrimSpace(reply.Text)}
+	// A language we don't know is as good as none
+	transcript.Language, _ = normalizeLanguage(reply.Language)
+	for _, s := range reply.Segments {
+		segment := TranscriptSegment{
+			Start:   seconds(s.Start),
+			End:     seconds(s.End),
+			Text:    strings.TrimSpace(s.Text),
+			Speaker: s.Speaker,
+		}
+		// avg_logprob is the mean log probability of the segment's tokens
+		if s.AvgLogprob != nil {
+			segment.Confidence = math.Min(1, math.Exp(*s.AvgLogprob))
+		}
+		if segment.Text != "" {
+			transcript.Segments = append(transcript.Segments, segment)
+		}
+	}
+
+	if len(transcript.Segments) == 0 && transcript.Text != "" {
+		transcript.Segments = []TranscriptSegment{{End: seconds(reply.Duration), Text: transcript.Text}}
+	}
+	return transcript, nil
+}
+
+func seconds(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
+
+// postAudio uploads audio as multipart/form-data along with the given fields
+// and returns the body of a 200 response. name is only used in error messages.
+func postAudio(ctx context.Context, client *httpclient.Client, name string, url string, apiKey string, audio io.Reader, filename string, fields map[string]string) ([]byte, error) {
+	//-------------------------------------------------------------------
+	// Build multipart/form-data body
+	//-------------------------------------------------------------------
+	var requestBody bytes.Buffer
+	writer := multipart.NewWriter(&requestBody)
+
+	// Add file field
+	part, err := writer.CreateFormFile("file", filename)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create form file for %s: %v", name, err)
+	}
+
+	// Copy file contents
+	if _, err := io.Copy(part, audio); err != nil {
+		return nil, fmt.Errorf("unable to copy file content: %v", err)
+	}
+
+	for key, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := writer.WriteField(key, value); err != nil {
+			return nil, fmt.Errorf("unable to add %s field: %v", key, err)
+		}
+	}
+
+	// Close writer
+	if err := writer.Close(); err != nil {
+		return nil, fmt.Errorf("error closing %s writer: %v", name, err)
+	}
+
+	//-------------------------------------------------------------------
+	// Prepare and send HTTP request
+	//-------------------------------------------------------------------
+	req, err := http.NewRequestWithContext(ctx, "POST", url, &requestBody)
+	if err != nil {
+		return nil, fmt.Errorf("error creating %s request: %v", name, err)
+	}
+
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	if apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+apiKey)
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error sending request to %s: %v", name, err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading %s response: %v", name, err)
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s returned status %d: %s", name, resp.StatusCode, string(respBody))
+	}
+
+	return respBody, nil
+}
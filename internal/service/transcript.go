@@ -0,0 +1,156 @@
+package service
+
+import (
+	"strings"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+)
+
+// Transcript is the text of a recording along with where every piece of it
+// was heard in the audio.
+type Transcript struct {
+	Text     string
+	Segments []TranscriptSegment
+	// Language is the ISO 639-1 code of the language spoken, if known
+	Language string
+}
+
+// TranscriptSegment is a piece of the transcript and the part of the original
+// recording it covers.
+type TranscriptSegment struct {
+	Start time.Duration
+	End   time.Duration
+	Text  string
+	// Confidence is between 0 and 1, or 0 when the provider doesn't say
+	Confidence float64
+	// Speaker is "Speaker 1", "Speaker 2", ... or empty when nobody told us
+	Speaker string
+}
+
+// lineEvery is the longest a line of the transcript the summarizer reads
+// runs before it gets a new timestamp.
+const lineEvery = 30 * time.Second
+
+// forSummary returns the transcript the way the summarizer reads it: a line
+// for every speaker turn, and at least every lineEvery, starting with the
+// time in the recording and the speaker's name, like
+//
+//	[00:12:30] Speaker 1: ...
+//
+// which is how it gets to know who said what, and when.
+func (t Transcript) forSummary() Transcript {
+	if len(t.Segments) == 0 {
+		return t
+	}
+
+	annotated := Transcript{Segments: make([]TranscriptSegment, 0, len(t.Segments)), Language: t.Language}
+	previous := ""
+	lineStart := time.Duration(-1)
+	for _, segment := range t.Segments {
+		if lineStart < 0 || segment.Speaker != previous || segment.Start-lineStart >= lineEvery {
+			prefix := "[" + formatTimestamp(segment.Start) + "] "
+			if segment.Speaker != "" {
+				prefix += segment.Speaker + ": "
+			}
+			segment.Text = prefix + segment.Text
+			if annotated.Text != "" {
+				annotated.Text += "\n"
+			}
+			lineStart = segment.Start
+		} else {
+			annotated.Text += " "
+		}
+		annotated.Text += segment.Text
+		annotated.Segments = append(annotated.Segments, segment)
+		previous = segment.Speaker
+	}
+	return annotated
+}
+
+// stitcher joins the transcripts of overlapping chunks, in order, into one.
+type stitcher struct {
+	transcript Transcript
+	// covered is how much of the recording the transcript has heard
+	covered time.Duration
+}
+
+// add appends the transcript of the next chunk and returns how many segments
+// it added. Segment times are moved by the chunk's offset, so they point into
+// the whole recording.
+func (st *stitcher) add(part Transcript, chunk audio.Chunk) int {
+	segments := make([]TranscriptSegment, 0, len(part.Segments))
+	for _, segment := range part.Segments {
+		segment.Start += chunk.Offset
+		segment.End += chunk.Offset
+		// Providers that don't time their text give it no length
+		if segment.End <= segment.Start {
+			segment.End = chunk.Offset + chunk.Duration
+		}
+		segments = append(segments, segment)
+	}
+	speakers := linkSpeakers(st.transcript.Segments, segments, chunk.Index)
+
+	added := 0
+	for _, segment := range segments {
+		// Neighbouring chunks overlap: skip what the previous chunk already
+		// had and drop the repeated words of a segment that straddles it
+		if segment.End <= st.covered {
+			continue
+		}
+		if segment.Start < st.covered {
+			segment.Text = trimOverlap(st.transcript.Text, segment.Text)
+			segment.Start = st.covered
+		}
+		if segment.Text == "" {
+			continue
+		}
+
+		if st.transcript.Text != "" {
+			st.transcript.Text += " "
+		}
+		st.transcript.Text += segment.Text
+		segment.Speaker = speakers[segment.Speaker]
+		st.transcript.Segments = append(st.transcript.Segments, segment)
+		st.covered = segment.End
+		added++
+	}
+	return added
+}
+
+// maxStitchWords is the longest run of words we look for when joining the
+// transcripts of two overlapping chunks.
+const maxStitchWords = 30
+
+// trimOverlap returns next without the words at its start that repeat the end
+// of prev because the chunks overlap.
+func trimOverlap(prev, next string) string {
+	prevWords := strings.Fields(prev)
+	nextWords := strings.Fields(next)
+
+	overlap := 0
+	for n := min(maxStitchWords, len(prevWords), len(nextWords)); n > 0; n-- {
+		if sameWords(prevWords[len(prevWords)-n:], nextWords[:n]) {
+			overlap = n
+			break
+		}
+	}
+
+	return strings.Join(nextWords[overlap:], " ")
+}
+
+func sameWords(a, b []string) bool {
+	for i := range a {
+		if normalizeWord(a[i]) != normalizeWord(b[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeWord ignores case and punctuation, which often differ at the cut.
+func normalizeWord(w string) string {
+	return strings.ToLower(strings.TrimFunc(w, func(r rune) bool {
+		return strings.ContainsRune(".,!?;:\"'()-", r)
+	}))
+}
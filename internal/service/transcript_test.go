@@ -0,0 +1,116 @@
+package service
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cyberhawk12121/Saarthi/internal/audio"
+)
+
+func TestTrimOverlap(t *testing.T) {
+	tests := []struct {
+		name string
+		prev string
+		next string
+		want string
+	}{
+		{"no overlap", "we should ship it", "on Friday then", "on Friday then"},
+		{"repeated words", "we should ship it", "ship it on Friday", "on Friday"},
+		{"case and punctuation differ", "we should ship it.", "Ship it, on Friday", "on Friday"},
+		{"longest run wins", "it is it is", "it is it is done", "done"},
+		{"everything repeated", "ship it", "ship it", ""},
+		{"empty previous", "", "ship it", "ship it"},
+		{"words in the middle don't count", "ship it on Friday", "ship it now", "ship it now"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := trimOverlap(tt.prev, tt.next); got != tt.want {
+				t.Errorf("trimOverlap(%q, %q) = %q, want %q", tt.prev, tt.next, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStitcher(t *testing.T) {
+	second := time.Second
+	first := audio.Chunk{Index: 0, Offset: 0, Duration: 10 * second}
+	next := audio.Chunk{Index: 1, Offset: 8 * second, Duration: 10 * second}
+
+	tests := []struct {
+		name      string
+		parts     []Transcript
+		chunks    []audio.Chunk
+		wantText  string
+		wantTimes [][2]time.Duration
+	}{
+		{
+			name: "segments are moved into the recording",
+			parts: []Transcript{
+				{Segments: []TranscriptSegment{{Start: 0, End: 4 * second, Text: "one two"}}},
+				{Segments: []TranscriptSegment{{Start: 3 * second, End: 6 * second, Text: "three four"}}},
+			},
+			chunks:    []audio.Chunk{first, next},
+			wantText:  "one two three four",
+			wantTimes: [][2]time.Duration{{0, 4 * second}, {11 * second, 14 * second}},
+		},
+		{
+			name: "segments the previous chunk had are skipped",
+			parts: []Transcript{
+				{Segments: []TranscriptSegment{{Start: 0, End: 9 * second, Text: "one two"}}},
+				{Segments: []TranscriptSegment{{Start: 0, End: 1 * second, Text: "two"}, {Start: 1 * second, End: 5 * second, Text: "three"}}},
+			},
+			chunks:    []audio.Chunk{first, next},
+			wantText:  "one two three",
+			wantTimes: [][2]time.Duration{{0, 9 * second}, {9 * second, 13 * second}},
+		},
+		{
+			name: "straddling segment loses its repeated words",
+			parts: []Transcript{
+				{Segments: []TranscriptSegment{{Start: 0, End: 10 * second, Text: "one two three"}}},
+				{Segments: []TranscriptSegment{{Start: 0, End: 4 * second, Text: "Two three, four five"}}},
+			},
+			chunks:    []audio.Chunk{first, next},
+			wantText:  "one two three four five",
+			wantTimes: [][2]time.Duration{{0, 10 * second}, {10 * second, 12 * second}},
+		},
+		{
+			name: "straddling segment with nothing new is dropped",
+			parts: []Transcript{
+				{Segments: []TranscriptSegment{{Start: 0, End: 10 * second, Text: "one two three"}}},
+				{Segments: []TranscriptSegment{{Start: 1 * second, End: 3 * second, Text: "three"}, {Start: 3 * second, End: 5 * second, Text: "four"}}},
+			},
+			chunks:    []audio.Chunk{first, next},
+			wantText:  "one two three four",
+			wantTimes: [][2]time.Duration{{0, 10 * second}, {11 * second, 13 * second}},
+		},
+		{
+			name: "untimed text spans the chunk",
+			parts: []Transcript{
+				{Segments: []TranscriptSegment{{Text: "one two"}}},
+				{Segments: []TranscriptSegment{{Text: "two three"}}},
+			},
+			chunks:    []audio.Chunk{first, next},
+			wantText:  "one two three",
+			wantTimes: [][2]time.Duration{{0, 10 * second}, {10 * second, 18 * second}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var st stitcher
+			for i, part := range tt.parts {
+				st.add(part, tt.chunks[i])
+			}
+			if st.transcript.Text != tt.wantText {
+				t.Errorf("text = %q, want %q", st.transcript.Text, tt.wantText)
+			}
+			if len(st.transcript.Segments) != len(tt.wantTimes) {
+				t.Fatalf("segments = %+v, want %d", st.transcript.Segments, len(tt.wantTimes))
+			}
+			for i, s := range st.transcript.Segments {
+				if s.Start != tt.wantTimes[i][0] || s.End != tt.wantTimes[i][1] {
+					t.Errorf("segment %d %q spans %v-%v, want %v-%v", i, s.Text, s.Start, s.End, tt.wantTimes[i][0], tt.wantTimes[i][1])
+				}
+			}
+		})
+	}
+}
@@ -2,18 +2,43 @@ package service
 
 import (
 	"database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"time"
 
+	"github.com/cyberhawk12121/Saarthi/internal/events"
+	"github.com/cyberhawk12121/Saarthi/internal/middleware"
 	"github.com/cyberhawk12121/Saarthi/internal/repository"
 	types "github.com/cyberhawk12121/Saarthi/internal/shared"
+	"github.com/cyberhawk12121/Saarthi/internal/storage"
 
+	"github.com/gin-gonic/gin"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// ErrInvalidCredentials is returned for an unknown email or a wrong password alike.
+var ErrInvalidCredentials = errors.New("invalid email or password")
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
 type UserService struct {
-	DB            *sql.DB
-	userRepo      *repository.UserRepository
-	recordingRepo *repository.RecordingRepository
-	config        *Config
+	DB             *sql.DB
+	userRepo       *repository.UserRepository
+	recordingRepo  *repository.RecordingRepository
+	jobRepo        *repository.JobRepository
+	transcriptRepo *repository.TranscriptRepository
+	summaryRepo    *repository.SummaryRepository
+	actionItemRepo *repository.ActionItemRepository
+	refreshRepo    *repository.RefreshTokenRepository
+	auth           *middleware.AuthJWT
+	config         *Config
+	transcriber    Transcriber
+	summarizer     Summarizer
+	diarizer       Diarizer
+	resources      ResourceProvider
+	store          storage.BlobStore
+	events         *events.Hub
 }
 
 func NewUserService(db *sql.DB) *UserService {
@@ -21,7 +46,47 @@ func NewUserService(db *sql.DB) *UserService {
 	if err != nil {
 		panic(err)
 	}
-	return &UserService{DB: db, userRepo: repository.NewUserRepository(db), recordingRepo: repository.NewRecordingRepository(db), config: config}
+	transcriber, err := NewTranscriber(config)
+	if err != nil {
+		panic(err)
+	}
+	summarizer, err := NewSummarizer(config)
+	if err != nil {
+		panic(err)
+	}
+	diarizer, err := NewDiarizer(config)
+	if err != nil {
+		panic(err)
+	}
+	resources, err := NewResourceProvider(config)
+	if err != nil {
+		panic(err)
+	}
+	if config.JWTSecret == "" {
+		panic("JWT_SECRET is not set")
+	}
+	store, err := NewBlobStore(config)
+	if err != nil {
+		panic(err)
+	}
+	return &UserService{
+		DB:             db,
+		userRepo:       repository.NewUserRepository(db),
+		recordingRepo:  repository.NewRecordingRepository(db),
+		jobRepo:        repository.NewJobRepository(db),
+		transcriptRepo: repository.NewTranscriptRepository(db),
+		summaryRepo:    repository.NewSummaryRepository(db),
+		actionItemRepo: repository.NewActionItemRepository(db),
+		refreshRepo:    repository.NewRefreshTokenRepository(db),
+		auth:           middleware.NewAuthJWT(db, []byte(config.JWTSecret), config.AccessTokenTTL, config.RefreshTokenTTL, config.StreamTokenTTL),
+		config:         config,
+		transcriber:    transcriber,
+		summarizer:     summarizer,
+		diarizer:       diarizer,
+		resources:      resources,
+		store:          store,
+		events:         events.NewHub(),
+	}
 }
 
 func (us *UserService) RegisterUser(userData types.RegisterRequest) error {
@@ -51,22 +116,77 @@ func (us *UserService) RegisterUser(userData types.RegisterRequest) error {
 	return nil
 }
 
-func (us *UserService) LoginUser(req types.LoginRequest) (types.LoginResponse, error) {
+// AuthMiddleware returns the middleware that protects every route behind login.
+func (us *UserService) AuthMiddleware() gin.HandlerFunc {
+	return us.auth.Handler()
+}
+
+// StreamAuthMiddleware is AuthMiddleware for the routes browsers open as event
+// streams or sockets, which also take a stream token in the URL.
+func (us *UserService) StreamAuthMiddleware() gin.HandlerFunc {
+	return us.auth.StreamHandler()
+}
+
+// dummyPasswordHash is checked when the email is unknown. It has the cost of
+// real hashes so both paths take the same time.
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("not a password"), bcrypt.DefaultCost)
+
+// LoginUser checks the credentials and starts a new session for the device
+// described by userAgent and ipAddress.
+func (us *UserService) LoginUser(req types.LoginRequest, userAgent string, ipAddress string) (types.LoginResponse, error) {
 	// 1. check if the user exists in the db
-	// 2. if the user exists then check if the password matches
-	// 3. if the password matches then create a jwt token and return the object
+	// 2. if the user exists then check if the password matches the stored bcrypt hash
+	// 3. if the password matches then start a session and return its access and refresh tokens
 	// 4. if the password doesn't match then return an error
-	bcryptedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	user, err := us.userRepo.GetUserByEmail(req.Email)
+	if err != nil {
+		return types.LoginResponse{}, err
+	}
+	if user.ID == "" {
+		// Take as long as a wrong password, or the timing tells which emails are registered
+		bcrypt.CompareHashAndPassword(dummyPasswordHash, []byte(req.Password))
+		return types.LoginResponse{}, ErrInvalidCredentials
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(req.Password)); err != nil {
+		return types.LoginResponse{}, ErrInvalidCredentials
+	}
+
+	sessionId, err := us.refreshRepo.CreateSession(user.ID, userAgent, ipAddress)
+	if err != nil {
+		return types.LoginResponse{}, fmt.Errorf("error creating session: %v", err)
+	}
+
+	return us.issueTokens(user.ID, sessionId)
+}
+
+// issueTokens signs a new access token and a new refresh token for the session.
+// The refresh token is recorded in the DB so it can be checked and rotated later.
+func (us *UserService) issueTokens(userId string, sessionId string) (types.LoginResponse, error) {
+	accessToken, accessExpiresAt, err := us.auth.IssueAccessToken(userId, sessionId)
 	if err != nil {
 		return types.LoginResponse{}, err
 	}
-	rows, err := us.DB.Query("SELECT * FROM users WHERE email=$1 & password=$2", req.Email, bcryptedPassword)
 
+	refreshId, err := us.refreshRepo.CreateRefreshToken(sessionId, userId, time.Now().Add(us.auth.RefreshTTL))
+	if err != nil {
+		return types.LoginResponse{}, fmt.Errorf("error storing refresh token: %v", err)
+	}
+	refreshToken, refreshExpiresAt, err := us.auth.IssueRefreshToken(userId, sessionId, refreshId)
 	if err != nil {
 		return types.LoginResponse{}, err
 	}
 
-	defer rows.Close()
+	return types.LoginResponse{
+		Token:            accessToken,
+		ExpiresAt:        accessExpiresAt.Format(time.RFC3339),
+		RefreshToken:     refreshToken,
+		RefreshExpiresAt: refreshExpiresAt.Format(time.RFC3339),
+	}, nil
+}
 
-	return types.LoginResponse{}, nil
+// isUUID checks the format before an ID reaches a uuid column, where Postgres
+// would reject it with an error instead of finding no rows.
+func isUUID(id string) bool {
+	return uuidPattern.MatchString(id)
 }
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+const (
+	defaultWhisperBaseURL = "https://api.openai.com/v1"
+	defaultWhisperModel   = "whisper-1"
+)
+
+// WhisperClient talks to any OpenAI-compatible /audio/transcriptions endpoint
+// (OpenAI itself, Groq, a faster-whisper server, ...).
+type WhisperClient struct {
+	BaseURL    string
+	APIKey     string
+	Model      string
+	Language   string
+	HTTPClient *httpclient.Client
+}
+
+func NewWhisperClient(baseURL, apiKey, model string) *WhisperClient {
+	if baseURL == "" {
+		baseURL = defaultWhisperBaseURL
+	}
+	if model == "" {
+		model = defaultWhisperModel
+	}
+	return &WhisperClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		APIKey:     apiKey,
+		Model:      model,
+		HTTPClient: providerClient("Whisper API", httpclient.DefaultOptions()),
+	}
+}
+
+func (wc *WhisperClient) Transcribe(ctx context.Context, file io.Reader, filename string) (Transcript, error) {
+	respBody, err := postAudio(ctx, wc.HTTPClient, "Whisper API", wc.BaseURL+"/audio/transcriptions", wc.APIKey, file, filename, map[string]string{
+		"model":           wc.Model,
+		"language":        wc.Language,
+		"response_format": "verbose_json",
+	})
+	if err != nil {
+		return Transcript{}, err
+	}
+
+	return parseVerboseTranscription("Whisper API", respBody)
+}
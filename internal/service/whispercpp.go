@@ -0,0 +1,42 @@
+package service
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/cyberhawk12121/Saarthi/internal/httpclient"
+)
+
+const defaultWhisperCppBaseURL = "http://localhost:8081"
+
+// WhisperCppClient talks to a local whisper.cpp server (examples/server), which
+// needs no API key and serves transcriptions on /inference.
+type WhisperCppClient struct {
+	BaseURL    string
+	Language   string
+	HTTPClient *httpclient.Client
+}
+
+func NewWhisperCppClient(baseURL string) *WhisperCppClient {
+	if baseURL == "" {
+		baseURL = defaultWhisperCppBaseURL
+	}
+	return &WhisperCppClient{
+		BaseURL:    strings.TrimRight(baseURL, "/"),
+		HTTPClient: providerClient("whisper.cpp", httpclient.DefaultOptions()),
+	}
+}
+
+func (wc *WhisperCppClient) Transcribe(ctx context.Context, file io.Reader, filename string) (Transcript, error) {
+	respBody, err := postAudio(ctx, wc.HTTPClient, "whisper.cpp", wc.BaseURL+"/inference", "", file, filename, map[string]string{
+		"language":        wc.Language,
+		"response_format": "verbose_json",
+		"temperature":     "0.0",
+	})
+	if err != nil {
+		return Transcript{}, err
+	}
+
+	return parseVerboseTranscription("whisper.cpp", respBody)
+}
@@ -15,7 +15,30 @@ type LoginRequest struct {
 }
 
 type LoginResponse struct {
-	Token string `json:"token"`
+	Token            string `json:"token"`
+	ExpiresAt        string `json:"expires_at"`
+	RefreshToken     string `json:"refresh_token"`
+	RefreshExpiresAt string `json:"refresh_expires_at"`
+}
+
+// StreamTokenResponse is the token browsers open event streams and live
+// sessions with, as ?token=.
+type StreamTokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresAt string `json:"expires_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type SessionResponse struct {
+	ID         string `json:"id"`
+	UserAgent  string `json:"user_agent"`
+	IPAddress  string `json:"ip_address"`
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"created_at"`
+	LastUsedAt string `json:"last_used_at"`
 }
 
 type User struct {
@@ -32,10 +55,65 @@ type UploadRequest struct {
 	File *multipart.FileHeader `json:"file"`
 }
 
+// CreateRecordingRequest starts a direct upload. Multipart is used when asked
+// for, or when the file is too big for a single PUT.
+type CreateRecordingRequest struct {
+	Filename    string `json:"filename"`
+	ContentType string `json:"content_type"`
+	Size        int64  `json:"size" binding:"required,gt=0"`
+	Multipart   bool   `json:"multipart"`
+	// Language overrides the user's default, "auto" detects it
+	Language string `json:"language"`
+}
+
+// ReprocessRequest overrides the configured models and language for one run
+// of POST /recordings/:id/reprocess. Empty fields keep the configured value.
+type ReprocessRequest struct {
+	TranscriptionModel string `json:"transcription_model"`
+	SummarizerModel    string `json:"summarizer_model"`
+	Language           string `json:"language"`
+}
+
+// RegenerateSummaryRequest overrides the configured summarizer model for one
+// run of POST /summaries/:id/regenerate. Empty keeps the configured model.
+type RegenerateSummaryRequest struct {
+	SummarizerModel string `json:"summarizer_model"`
+}
+
+type PresignedPart struct {
+	PartNumber int32  `json:"part_number"`
+	URL        string `json:"url"`
+}
+
+// CreateRecordingResponse tells the client where to PUT the file: either the
+// whole file to UploadURL, or each part to its URL in Parts.
+type CreateRecordingResponse struct {
+	RecordingID int             `json:"recording_id"`
+	Key         string          `json:"key"`
+	UploadURL   string          `json:"upload_url,omitempty"`
+	UploadID    string          `json:"upload_id,omitempty"`
+	PartSize    int64           `json:"part_size,omitempty"`
+	Parts       []PresignedPart `json:"parts,omitempty"`
+	ExpiresAt   string          `json:"expires_at"`
+}
+
+type CompletedPart struct {
+	PartNumber int32  `json:"part_number"`
+	ETag       string `json:"etag"`
+}
+
+// CompleteRecordingRequest is only needed for multipart uploads.
+type CompleteRecordingRequest struct {
+	UploadID string          `json:"upload_id"`
+	Parts    []CompletedPart `json:"parts"`
+}
+
 type SummarylistResponse struct {
 	ID          int    `json:"id"`
+	RecordingID int    `json:"recording_id"`
 	Title       string `json:"title"`
 	Description string `json:"description"`
+	Version     int    `json:"version"`
 	// Thumbnail   string `json:"thumbnail"`	// optional maybe for future
 	AudioURL string `json:"audio_url"`
 	// Transcript string `json:"transcript"`
@@ -43,10 +121,192 @@ type SummarylistResponse struct {
 	UpdatedAt string `json:"updated_at"`
 }
 
+// SummaryPage is one page of GET /summaries
+type SummaryPage struct {
+	Summaries []SummarylistResponse `json:"summaries"`
+	Page      int                   `json:"page"`
+	Limit     int                   `json:"limit"`
+	Total     int                   `json:"total"`
+}
+
+type SummaryDetailResponse struct {
+	ID          int            `json:"id"`
+	RecordingID int            `json:"recording_id"`
+	Version     int            `json:"version"`
+	Summary     MeetingSummary `json:"summary"`
+	Transcript  string         `json:"transcript"`
+	// Segments time the transcript, so a client can jump to the moment in
+	// the recording (AudioURL) that a line was said
+	Segments []TranscriptSegment `json:"segments"`
+	// Language is the language spoken in the recording, if it is known
+	Language string `json:"language,omitempty"`
+	// Speakers lists the speaker labels of the transcript and who they are
+	Speakers  []Speaker `json:"speakers"`
+	AudioURL  string    `json:"audio_url,omitempty"`
+	CreatedAt string    `json:"created_at"`
+	UpdatedAt string    `json:"updated_at"`
+}
+
+// TranscriptSegment is a timed piece of a transcript, in seconds from the
+// start of the recording.
+type TranscriptSegment struct {
+	Start      float64  `json:"start"`
+	End        float64  `json:"end"`
+	Text       string   `json:"text"`
+	Confidence *float64 `json:"confidence,omitempty"`
+	// Speaker is the speaker's name if they were given one, or their label
+	Speaker string `json:"speaker,omitempty"`
+}
+
+// Speaker is a speaker label of a transcript, like "Speaker 1", and the name
+// of the participant behind it, if somebody set one.
+type Speaker struct {
+	Label string `json:"label"`
+	Name  string `json:"name,omitempty"`
+}
+
+// Preferences are the user's settings. Language is the default language of
+// their recordings: an ISO 639-1 code, "auto" to detect it, or empty for the
+// server's default.
+type Preferences struct {
+	Language string `json:"language"`
+}
+
+// RenameSpeakerRequest names the participant behind a speaker label.
+type RenameSpeakerRequest struct {
+	Label string `json:"label" binding:"required"`
+	Name  string `json:"name" binding:"required"`
+}
+
 // LlamaRequest models the request payload sent to the Llama API
 type LlamaRequest struct {
+	Model        string                   `json:"model,omitempty"`
 	Messages     []map[string]string      `json:"messages"`
 	Functions    []map[string]interface{} `json:"functions"`
 	Stream       bool                     `json:"stream"`
 	FunctionCall string                   `json:"function_call"` // If you want explicit function calls
 }
+
+// MeetingSummary is the structured summary the Summarizer is asked to produce
+type MeetingSummary struct {
+	Title         string       `json:"title"`
+	TLDR          string       `json:"tldr"`
+	KeyPoints     []string     `json:"key_points"`
+	Decisions     []string     `json:"decisions"`
+	ActionItems   []ActionItem `json:"action_items"`
+	OpenQuestions []string     `json:"open_questions"`
+	// Sections is only set for meetings too long to summarize in one request
+	Sections []SummarySection `json:"sections,omitempty"`
+	// Resources is only set when a RESOURCE_PROVIDER is configured
+	Resources []ResourceTopic `json:"resources,omitempty"`
+}
+
+// SummarySection is the summary of one part of a long meeting. Start and End
+// are seconds from the start of the recording.
+type SummarySection struct {
+	Start float64 `json:"start"`
+	End   float64 `json:"end"`
+	Title string  `json:"title"`
+	TLDR  string  `json:"tldr"`
+}
+
+// ResourceTopic is a topic of the meeting worth reading more about, with the
+// searches it was looked up with and what they found.
+type ResourceTopic struct {
+	Topic     string     `json:"topic"`
+	Queries   []string   `json:"queries"`
+	Resources []Resource `json:"resources"`
+}
+
+// Resource is a link to read more about a topic.
+type Resource struct {
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Snippet string `json:"snippet,omitempty"`
+}
+
+type ActionItem struct {
+	Description string `json:"description"`
+	Owner       string `json:"owner,omitempty"`
+	DueDate     string `json:"due_date,omitempty"` // YYYY-MM-DD
+	// Timestamp is where in the recording it was agreed, as HH:MM:SS
+	Timestamp string `json:"timestamp,omitempty"`
+}
+
+// UpdateActionItemRequest changes an action item on PATCH /action-items/:id.
+// Missing fields are left alone; an empty assignee unassigns it.
+type UpdateActionItemRequest struct {
+	Status   *string `json:"status"`
+	Assignee *string `json:"assignee"`
+}
+
+// Events of GET /recordings/:id/events. Every one names the job it is about,
+// since a recording can be reprocessed.
+
+// StageEvent is sent when a job moves to another stage. Error is set when it failed.
+type StageEvent struct {
+	JobID string `json:"job_id"`
+	Stage string `json:"stage"`
+	Error string `json:"error,omitempty"`
+}
+
+// ProgressEvent is sent once the chunks are known and after every finished chunk.
+type ProgressEvent struct {
+	JobID       string `json:"job_id"`
+	ChunksDone  int    `json:"chunks_done"`
+	ChunksTotal int    `json:"chunks_total"`
+}
+
+// TranscriptEvent is the transcript of one chunk, as soon as it is ready.
+// Chunks finish in any order and overlap a little; the stitched transcript
+// comes with the summary. Live sessions send the new part of the stitched
+// transcript instead, in order.
+type TranscriptEvent struct {
+	JobID    string              `json:"job_id"`
+	Chunk    int                 `json:"chunk"`
+	Start    float64             `json:"start"`
+	End      float64             `json:"end"`
+	Text     string              `json:"text"`
+	Segments []TranscriptSegment `json:"segments"`
+}
+
+// SummaryDeltaEvent is the next piece of the summary while the LLM writes it:
+// the JSON of the summary, token by token.
+type SummaryDeltaEvent struct {
+	JobID string `json:"job_id"`
+	Text  string `json:"text"`
+}
+
+// SummaryEvent is the finished summary.
+type SummaryEvent struct {
+	JobID     string         `json:"job_id"`
+	SummaryID int            `json:"summary_id"`
+	Summary   MeetingSummary `json:"summary"`
+}
+
+// LiveMessage is a text message of a live session on GET /live. The client
+// sends "start" (see LiveStartMessage) and "stop"; the server sends "started"
+// (see LiveStartedEvent), "error" and the events of GET /recordings/:id/events
+// under their event type.
+type LiveMessage struct {
+	Type string      `json:"type"`
+	Data interface{} `json:"data,omitempty"`
+}
+
+// LiveStartMessage opens a live session. The audio follows as binary messages
+// of raw little-endian PCM in this format, 16 kHz 16-bit mono by default.
+type LiveStartMessage struct {
+	Type          string `json:"type"`
+	Encoding      string `json:"encoding"`
+	SampleRate    int    `json:"sample_rate"`
+	Channels      int    `json:"channels"`
+	BitsPerSample int    `json:"bits_per_sample"`
+	// Language is the language spoken, "auto" to detect it; empty uses the user's default
+	Language string `json:"language"`
+}
+
+// LiveStartedEvent tells the client where its session is stored.
+type LiveStartedEvent struct {
+	RecordingID int    `json:"recording_id"`
+	JobID       string `json:"job_id"`
+}
@@ -0,0 +1,85 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+	"net/url"
+	"sync"
+	"time"
+)
+
+type memoryObject struct {
+	data []byte
+	info ObjectInfo
+}
+
+// MemoryStore keeps objects in memory. It is meant for development and tests:
+// everything is lost on restart.
+type MemoryStore struct {
+	Signer *URLSigner
+
+	mu      sync.RWMutex
+	objects map[string]memoryObject
+}
+
+func NewMemoryStore(signer *URLSigner) *MemoryStore {
+	return &MemoryStore{Signer: signer, objects: make(map[string]memoryObject)}
+}
+
+func (ms *MemoryStore) Put(ctx context.Context, key string, r io.Reader) (ObjectInfo, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	sum := md5.Sum(data)
+	info := ObjectInfo{
+		Key:          key,
+		Size:         int64(len(data)),
+		ETag:         hex.EncodeToString(sum[:]),
+		LastModified: time.Now(),
+	}
+
+	ms.mu.Lock()
+	ms.objects[key] = memoryObject{data: data, info: info}
+	ms.mu.Unlock()
+	return info, nil
+}
+
+func (ms *MemoryStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	ms.mu.RLock()
+	obj, ok := ms.objects[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	// Put never modifies a stored slice, so readers can share it
+	return io.NopCloser(bytes.NewReader(obj.data)), nil
+}
+
+func (ms *MemoryStore) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	ms.mu.RLock()
+	obj, ok := ms.objects[key]
+	ms.mu.RUnlock()
+	if !ok {
+		return ObjectInfo{}, ErrNotFound
+	}
+	return obj.info, nil
+}
+
+func (ms *MemoryStore) Delete(ctx context.Context, key string) error {
+	ms.mu.Lock()
+	delete(ms.objects, key)
+	ms.mu.Unlock()
+	return nil
+}
+
+func (ms *MemoryStore) Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error) {
+	return ms.Signer.Sign(method, key, ttl), nil
+}
+
+func (ms *MemoryStore) Verify(method string, key string, query url.Values) error {
+	return ms.Signer.Verify(method, key, query)
+}
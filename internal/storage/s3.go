@@ -0,0 +1,245 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/feature/s3/manager"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+type S3Options struct {
+	Region string
+	Bucket string
+	// AccessKeyID and SecretAccessKey are optional, the default AWS credential
+	// chain is used without them.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Endpoint and ForcePathStyle are for S3-compatible stores such as MinIO
+	Endpoint       string
+	ForcePathStyle bool
+	// PartSize and Concurrency tune the streaming multipart upload of Put
+	PartSize    int64
+	Concurrency int
+}
+
+// S3Store keeps objects in an S3 bucket. The client is built once and shared.
+type S3Store struct {
+	client   *s3.Client
+	presign  *s3.PresignClient
+	uploader *manager.Uploader
+	bucket   string
+}
+
+func NewS3Store(ctx context.Context, opts S3Options) (*S3Store, error) {
+	loadOpts := []func(*config.LoadOptions) error{
+		config.WithRegion(opts.Region),
+	}
+	if opts.AccessKeyID != "" {
+		loadOpts = append(loadOpts, config.WithCredentialsProvider(
+			credentials.NewStaticCredentialsProvider(opts.AccessKeyID, opts.SecretAccessKey, ""),
+		))
+	}
+
+	cfg, err := config.LoadDefaultConfig(ctx, loadOpts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading AWS config: %v", err)
+	}
+
+	client := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if opts.Endpoint != "" {
+			o.BaseEndpoint = aws.String(opts.Endpoint)
+		}
+		o.UsePathStyle = opts.ForcePathStyle
+	})
+
+	return &S3Store{
+		client:  client,
+		presign: s3.NewPresignClient(client),
+		uploader: manager.NewUploader(client, func(u *manager.Uploader) {
+			if opts.PartSize > 0 {
+				u.PartSize = opts.PartSize
+			}
+			if opts.Concurrency > 0 {
+				u.Concurrency = opts.Concurrency
+			}
+			// Abort a failed multipart upload so no orphaned parts are left behind
+			u.LeavePartsOnError = false
+		}),
+		bucket: opts.Bucket,
+	}, nil
+}
+
+// Put streams r with the upload manager, which sends it as a multipart upload
+// when it is bigger than a part.
+func (ss *S3Store) Put(ctx context.Context, key string, r io.Reader) (ObjectInfo, error) {
+	// Count the bytes on the way through, the upload output doesn't say
+	counter := &countingReader{r: r}
+	out, err := ss.uploader.Upload(ctx, &s3.PutObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+		Body:   counter,
+	})
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          aws.ToString(out.Key),
+		Size:         counter.n,
+		ETag:         trimETag(out.ETag),
+		LastModified: time.Now(),
+	}, nil
+}
+
+func (ss *S3Store) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	out, err := ss.client.GetObject(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return out.Body, nil
+}
+
+func (ss *S3Store) Head(ctx context.Context, key string) (ObjectInfo, error) {
+	out, err := ss.client.HeadObject(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		var notFound *s3types.NotFound
+		if errors.As(err, &notFound) {
+			return ObjectInfo{}, ErrNotFound
+		}
+		return ObjectInfo{}, err
+	}
+	return ObjectInfo{
+		Key:          key,
+		Size:         aws.ToInt64(out.ContentLength),
+		ETag:         trimETag(out.ETag),
+		LastModified: aws.ToTime(out.LastModified),
+	}, nil
+}
+
+func (ss *S3Store) Delete(ctx context.Context, key string) error {
+	_, err := ss.client.DeleteObject(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(ss.bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+func (ss *S3Store) Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error) {
+	expires := s3.WithPresignExpires(ttl)
+	switch method {
+	case http.MethodGet:
+		req, err := ss.presign.PresignGetObject(ctx, &s3.GetObjectInput{
+			Bucket: aws.String(ss.bucket),
+			Key:    aws.String(key),
+		}, expires)
+		if err != nil {
+			return "", err
+		}
+		return req.URL, nil
+	case http.MethodPut:
+		req, err := ss.presign.PresignPutObject(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(ss.bucket),
+			Key:    aws.String(key),
+		}, expires)
+		if err != nil {
+			return "", err
+		}
+		return req.URL, nil
+	default:
+		return "", fmt.Errorf("cannot presign %s requests", method)
+	}
+}
+
+// PresignMultipart starts a multipart upload and presigns every part of it.
+func (ss *S3Store) PresignMultipart(ctx context.Context, key string, contentType string, size int64, partSize int64, ttl time.Duration) (string, []string, error) {
+	var ct *string
+	if contentType != "" {
+		ct = aws.String(contentType)
+	}
+	upload, err := ss.client.CreateMultipartUpload(ctx, &s3.CreateMultipartUploadInput{
+		Bucket:      aws.String(ss.bucket),
+		Key:         aws.String(key),
+		ContentType: ct,
+	})
+	if err != nil {
+		return "", nil, fmt.Errorf("error starting multipart upload: %v", err)
+	}
+
+	parts := int32((size + partSize - 1) / partSize)
+	urls := make([]string, 0, parts)
+	for partNumber := int32(1); partNumber <= parts; partNumber++ {
+		part, err := ss.presign.PresignUploadPart(ctx, &s3.UploadPartInput{
+			Bucket:     aws.String(ss.bucket),
+			Key:        aws.String(key),
+			UploadId:   upload.UploadId,
+			PartNumber: aws.Int32(partNumber),
+		}, s3.WithPresignExpires(ttl))
+		if err != nil {
+			// Nobody can finish the upload, S3 would keep its parts around
+			ss.client.AbortMultipartUpload(context.Background(), &s3.AbortMultipartUploadInput{
+				Bucket:   aws.String(ss.bucket),
+				Key:      aws.String(key),
+				UploadId: upload.UploadId,
+			})
+			return "", nil, fmt.Errorf("error presigning part %d: %v", partNumber, err)
+		}
+		urls = append(urls, part.URL)
+	}
+
+	return aws.ToString(upload.UploadId), urls, nil
+}
+
+func (ss *S3Store) CompleteMultipart(ctx context.Context, key string, uploadId string, parts []Part) error {
+	completed := make([]s3types.CompletedPart, 0, len(parts))
+	for _, p := range parts {
+		completed = append(completed, s3types.CompletedPart{PartNumber: aws.Int32(p.Number), ETag: aws.String(p.ETag)})
+	}
+	sort.Slice(completed, func(i, j int) bool { return *completed[i].PartNumber < *completed[j].PartNumber })
+
+	_, err := ss.client.CompleteMultipartUpload(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(ss.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadId),
+		MultipartUpload: &s3types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return fmt.Errorf("error completing multipart upload: %v", err)
+	}
+	return nil
+}
+
+// trimETag drops the quotes S3 puts around ETags.
+func trimETag(etag *string) string {
+	return strings.Trim(aws.ToString(etag), `"`)
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
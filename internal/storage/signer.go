@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSignature = errors.New("invalid or expired signature")
+
+// URLSigner presigns URLs for the stores that have no presigning of their own
+// (local disk and memory). The URLs point at BaseURL + "/storage/<key>" and
+// are checked with Verify by the handler serving that route.
+type URLSigner struct {
+	BaseURL string
+	Secret  []byte
+}
+
+func NewURLSigner(baseURL string, secret []byte) *URLSigner {
+	return &URLSigner{BaseURL: strings.TrimSuffix(baseURL, "/"), Secret: secret}
+}
+
+// Sign returns a URL for method on key that is valid for ttl.
+func (s *URLSigner) Sign(method string, key string, ttl time.Duration) string {
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+
+	query := url.Values{}
+	query.Set("expires", expires)
+	query.Set("signature", s.signature(method, key, expires))
+
+	return fmt.Sprintf("%s/storage/%s?%s", s.BaseURL, escapeKey(key), query.Encode())
+}
+
+// Verify checks the expires and signature query parameters of a URL made by Sign.
+func (s *URLSigner) Verify(method string, key string, query url.Values) error {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || time.Now().Unix() > unix {
+		return ErrInvalidSignature
+	}
+
+	want := s.signature(method, key, expires)
+	if !hmac.Equal([]byte(want), []byte(query.Get("signature"))) {
+		return ErrInvalidSignature
+	}
+	return nil
+}
+
+func (s *URLSigner) signature(method string, key string, expires string) string {
+	mac := hmac.New(sha256.New, s.Secret)
+	mac.Write([]byte(strings.ToUpper(method) + "\n" + key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// escapeKey escapes every segment of the key but keeps the slashes.
+func escapeKey(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	return strings.Join(segments, "/")
+}
+
+// SignedStore is implemented by stores whose presigned URLs point back at us
+// rather than at a storage service.
+type SignedStore interface {
+	BlobStore
+	// Verify checks the query of a presigned URL for method on key.
+	Verify(method string, key string, query url.Values) error
+}
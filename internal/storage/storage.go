@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned by Get and Head when there is no object under the key.
+	ErrNotFound = errors.New("object not found")
+	// ErrInvalidKey is returned for keys that would escape the store, such as "../x".
+	ErrInvalidKey = errors.New("invalid object key")
+)
+
+// ObjectInfo describes a stored object.
+type ObjectInfo struct {
+	Key  string
+	Size int64
+	// ETag is the hex MD5 of the content for single-part uploads, without quotes.
+	ETag         string
+	LastModified time.Time
+}
+
+// BlobStore keeps the recordings. Keys are slash-separated paths.
+type BlobStore interface {
+	// Put streams r into the object under key, replacing any existing one.
+	Put(ctx context.Context, key string, r io.Reader) (ObjectInfo, error)
+	// Get opens the object for reading. The caller closes it.
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Head(ctx context.Context, key string) (ObjectInfo, error)
+	// Delete removes the object. Deleting a missing object is not an error.
+	Delete(ctx context.Context, key string) error
+	// Presign returns a URL that lets anyone holding it GET or PUT the object
+	// until ttl runs out, without going through our API.
+	Presign(ctx context.Context, method string, key string, ttl time.Duration) (string, error)
+}
+
+// Part is an uploaded part of a multipart upload.
+type Part struct {
+	Number int32
+	ETag   string
+}
+
+// MultipartStore is implemented by stores that can take an upload in parts
+// sent straight from the client.
+type MultipartStore interface {
+	// PresignMultipart starts a multipart upload of size bytes and presigns a
+	// URL for every partSize part of it.
+	PresignMultipart(ctx context.Context, key string, contentType string, size int64, partSize int64, ttl time.Duration) (uploadId string, urls []string, err error)
+	// CompleteMultipart stitches the parts together into the object.
+	CompleteMultipart(ctx context.Context, key string, uploadId string, parts []Part) error
+}
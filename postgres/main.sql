@@ -10,17 +10,63 @@ CREATE TABLE IF NOT EXISTS users (
     last_name  VARCHAR(150) NOT NULL,
     email VARCHAR(150) UNIQUE NOT NULL,
     password VARCHAR(150) NOT NULL,
+    -- ISO 639-1 code or 'auto', used for recordings uploaded without a language
+    language VARCHAR(10),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
 );
 
 CREATE INDEX IF NOT EXISTS user_email ON users(email);
 
+ALTER TABLE users ADD COLUMN IF NOT EXISTS language VARCHAR(10);
+
+CREATE TABLE IF NOT EXISTS sessions (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    user_id uuid NOT NULL,
+    user_agent TEXT,
+    ip_address VARCHAR(64),
+    revoked_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    last_used_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS session_user_id ON sessions(user_id);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    session_id uuid NOT NULL,
+    user_id uuid NOT NULL,
+    -- Set and checked against the application clock, so it keeps the zone
+    expires_at TIMESTAMPTZ NOT NULL,
+    used_at TIMESTAMP,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (session_id) REFERENCES sessions(id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+-- Databases created before refresh tokens belonged to a session: tokens
+-- without one can't be rotated, so their users sign in again
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS session_id uuid REFERENCES sessions(id);
+ALTER TABLE refresh_tokens ADD COLUMN IF NOT EXISTS used_at TIMESTAMP;
+DELETE FROM refresh_tokens WHERE session_id IS NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN session_id SET NOT NULL;
+ALTER TABLE refresh_tokens ALTER COLUMN expires_at TYPE TIMESTAMPTZ;
+DROP INDEX IF EXISTS refresh_token_user_id;
+
+CREATE INDEX IF NOT EXISTS refresh_token_session_id ON refresh_tokens(session_id);
+
 CREATE TABLE IF NOT EXISTS recording (
     id SERIAL PRIMARY KEY,
-    user_id uuid UNIQUE NOT NULL,
+    user_id uuid NOT NULL,
     is_deleted BOOLEAN DEFAULT FALSE,
     uploaded BOOLEAN DEFAULT FALSE,
+    -- Set by the application from the inserted row, the only source of the object key
+    storage_key TEXT UNIQUE,
+    etag TEXT,
+    -- The language asked for on upload ('auto' to detect it) and the one the transcription found
+    language VARCHAR(10),
+    detected_language VARCHAR(10),
     created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
     CONSTRAINT recording_id UNIQUE (user_id, id),
@@ -29,5 +75,117 @@ CREATE TABLE IF NOT EXISTS recording (
 
 CREATE INDEX IF NOT EXISTS recording_id ON recording(id);
 
+-- Databases created before users could have more than one recording
+ALTER TABLE recording DROP CONSTRAINT IF EXISTS recording_user_id_key;
+ALTER TABLE recording ADD COLUMN IF NOT EXISTS storage_key TEXT UNIQUE;
+ALTER TABLE recording ADD COLUMN IF NOT EXISTS etag TEXT;
+ALTER TABLE recording ADD COLUMN IF NOT EXISTS language VARCHAR(10);
+ALTER TABLE recording ADD COLUMN IF NOT EXISTS detected_language VARCHAR(10);
+UPDATE recording SET storage_key = id || '-' || user_id WHERE storage_key IS NULL;
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id uuid PRIMARY KEY DEFAULT uuid_generate_v4(),
+    recording_id INTEGER NOT NULL,
+    user_id uuid NOT NULL,
+    stage VARCHAR(20) NOT NULL DEFAULT 'uploading',
+    chunks_total INTEGER NOT NULL DEFAULT 0,
+    chunks_done INTEGER NOT NULL DEFAULT 0,
+    result JSONB,
+    error TEXT,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (recording_id) REFERENCES recording(id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS job_recording_id ON jobs(recording_id);
+
+CREATE TABLE IF NOT EXISTS transcripts (
+    id SERIAL PRIMARY KEY,
+    recording_id INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    FOREIGN KEY (recording_id) REFERENCES recording(id)
+);
+
+CREATE INDEX IF NOT EXISTS transcript_recording_id ON transcripts(recording_id);
+
+CREATE TABLE IF NOT EXISTS transcript_segments (
+    id SERIAL PRIMARY KEY,
+    transcript_id INTEGER NOT NULL,
+    position INTEGER NOT NULL,
+    start_seconds DOUBLE PRECISION NOT NULL,
+    end_seconds DOUBLE PRECISION NOT NULL,
+    text TEXT NOT NULL,
+    confidence DOUBLE PRECISION,
+    speaker TEXT,
+    CONSTRAINT transcript_segment_position UNIQUE(transcript_id, position),
+    FOREIGN KEY (transcript_id) REFERENCES transcripts(id) ON DELETE CASCADE
+);
+
+ALTER TABLE transcript_segments ADD COLUMN IF NOT EXISTS speaker TEXT;
+
+CREATE TABLE IF NOT EXISTS transcript_speakers (
+    transcript_id INTEGER NOT NULL,
+    label TEXT NOT NULL,
+    name TEXT NOT NULL,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (transcript_id, label),
+    FOREIGN KEY (transcript_id) REFERENCES transcripts(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS summaries (
+    id SERIAL PRIMARY KEY,
+    recording_id INTEGER NOT NULL,
+    transcript_id INTEGER NOT NULL,
+    user_id uuid NOT NULL,
+    title TEXT NOT NULL,
+    tldr TEXT NOT NULL,
+    content JSONB NOT NULL,
+    version INTEGER NOT NULL DEFAULT 1,
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT summary_recording_version UNIQUE (recording_id, version),
+    FOREIGN KEY (recording_id) REFERENCES recording(id),
+    FOREIGN KEY (transcript_id) REFERENCES transcripts(id),
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS summary_user_created_at ON summaries(user_id, created_at DESC);
+
+ALTER TABLE summaries ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+-- Summaries from before versions all got version 1, number them by age first
+IF NOT EXISTS (SELECT 1 FROM pg_constraint WHERE conname = 'summary_recording_version') THEN
+    UPDATE summaries SET version = numbered.version
+    FROM (
+        SELECT id, ROW_NUMBER() OVER (PARTITION BY recording_id ORDER BY created_at, id) AS version
+        FROM summaries
+    ) numbered
+    WHERE summaries.id = numbered.id;
+    ALTER TABLE summaries ADD CONSTRAINT summary_recording_version UNIQUE (recording_id, version);
+END IF;
+
+CREATE TABLE IF NOT EXISTS action_items (
+    id SERIAL PRIMARY KEY,
+    recording_id INTEGER NOT NULL,
+    summary_id INTEGER NOT NULL,
+    user_id uuid NOT NULL,
+    position INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    assignee TEXT,
+    due_date DATE,
+    source_seconds DOUBLE PRECISION,
+    status TEXT NOT NULL DEFAULT 'open',
+    created_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP,
+    CONSTRAINT action_item_status CHECK (status IN ('open', 'done')),
+    FOREIGN KEY (recording_id) REFERENCES recording(id),
+    FOREIGN KEY (summary_id) REFERENCES summaries(id) ON DELETE CASCADE,
+    FOREIGN KEY (user_id) REFERENCES users(user_id)
+);
+
+CREATE INDEX IF NOT EXISTS action_item_user_status ON action_items(user_id, status);
+CREATE INDEX IF NOT EXISTS action_item_summary_id ON action_items(summary_id);
+
 END
 $$
\ No newline at end of file